@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ComputeBroadcast returns the broadcast address of an IPv4 address's subnet,
+// e.g. 192.168.1.255 for 192.168.1.7/24. IPv6 has no broadcast, and neither
+// have /31 and /32 subnets (RFC 3021); those, like a Netmask that does not
+// fit the IP, yield nil.
+func (a *InterfaceAddress) ComputeBroadcast() net.IP {
+	n := a.Network()
+	if n == nil {
+		return nil
+	}
+	ip := n.IP.To4()
+	if ip == nil {
+		return nil
+	}
+	mask := n.Mask[len(n.Mask)-net.IPv4len:]
+	if ones, _ := mask.Size(); ones >= 31 {
+		return nil
+	}
+	b := make(net.IP, net.IPv4len)
+	for i := range b {
+		b[i] = ip[i] | ^mask[i]
+	}
+	return b
+}
+
+// checkBroadcast returns an error if Broadaddr is set and is not the
+// computed broadcast address.
+func (a *InterfaceAddress) checkBroadcast() error {
+	if a.Broadaddr == nil {
+		return nil
+	}
+	if want := a.ComputeBroadcast(); !a.Broadaddr.Equal(want) {
+		return fmt.Errorf("broadcast %v does not match %v, want %v", a.Broadaddr, a.Network(), want)
+	}
+	return nil
+}
+
+// AddAddress adds a to the interface, filling in Broadaddr from IP and
+// Netmask when it is nil. A Broadaddr that disagrees with them is rejected.
+// Like the rest of an Interface, addresses must not be added while a Router
+// using the interface is looking up routes.
+func (i *Interface) AddAddress(a *InterfaceAddress) error {
+	if a.Broadaddr == nil {
+		a.Broadaddr = a.ComputeBroadcast()
+	} else if err := a.checkBroadcast(); err != nil {
+		return err
+	}
+	i.addrs = append(i.addrs, a)
+	return nil
+}
+
+// Preferred reports whether the address is neither deprecated nor tentative.
+func (a *InterfaceAddress) Preferred() bool {
+	return !a.Deprecated && !a.Tentative
+}
+
+// rank orders addresses for source selection: preferred first, then
+// deprecated, then tentative ones.
+func (a *InterfaceAddress) rank() int {
+	switch {
+	case a.Tentative:
+		return 2
+	case a.Deprecated:
+		return 1
+	}
+	return 0
+}
+
+// bestRanked returns the first address of the lowest rank that satisfies ok,
+// or nil if none does.
+func bestRanked(a []*InterfaceAddress, ok func(*InterfaceAddress) bool) *InterfaceAddress {
+	var best *InterfaceAddress
+	for _, addr := range a {
+		if ok(addr) && (best == nil || addr.rank() < best.rank()) {
+			best = addr
+			if best.rank() == 0 {
+				break
+			}
+		}
+	}
+	return best
+}
+
+// Validate checks that the address is consistent: a valid IP, a contiguous
+// Netmask of the IP's family, and a Gateway and Broadaddr on the subnet they
+// imply.
+func (a *InterfaceAddress) Validate() error {
+	if a.IP.To16() == nil {
+		return errors.New("invalid IP")
+	}
+	if _, bits := a.Netmask.Size(); bits == 0 {
+		return fmt.Errorf("netmask %v is not a contiguous mask", maskString(a.Netmask))
+	}
+	if a.Network() == nil {
+		return fmt.Errorf("netmask %v does not fit the IP's family", maskString(a.Netmask))
+	}
+	if a.Gateway != nil && !a.Contains(a.Gateway) {
+		return fmt.Errorf("gateway %v is not on %v", a.Gateway, a.Network())
+	}
+	return a.checkBroadcast()
+}
+
+// Validate checks every address of the interface, see
+// InterfaceAddress.Validate.
+func (i *Interface) Validate() error {
+	var errs []error
+	for _, a := range i.addrs {
+		if err := a.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("interface %d (%s) address %v: %w", i.Id, i.Name, a.IP, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"math"
+	"net"
+)
+
+// LookupAdjusted is Lookup as if the priority of every route via an
+// interface were shifted by adjust[id], e.g. {eth1: -100} to see what
+// happens if eth1 were preferred. Adjusted priorities are clamped to the
+// uint32 range and the table is left unchanged. With WithComparator the
+// comparator decides the order alone and adjust is ignored.
+func (r *Router) LookupAdjusted(src, dst net.IP, adjust map[int64]int) (*RTInfo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	q := query{src: src, dst: dst}
+	if len(adjust) > 0 {
+		q.adjust = adjust
+	}
+	return r.routeTables([]*table{r.main}, q)
+}
+
+// lessFor returns the order candidates for q are sorted in, or nil for the
+// order of the trie.
+func (r *Router) lessFor(q query) func(a, b *RTInfo) bool {
+	if q.adjust == nil || r.less != nil {
+		return r.less
+	}
+	return func(a, b *RTInfo) bool {
+		return routeLessPriority(a, b, adjustedPriority(a, q.adjust), adjustedPriority(b, q.adjust))
+	}
+}
+
+// sameCostFor is sameCost under the order of lessFor(q).
+func (r *Router) sameCostFor(q query, a, b *RTInfo) bool {
+	if q.adjust == nil || r.less != nil {
+		return r.sameCost(a, b)
+	}
+	return sameCostPriority(a, b, adjustedPriority(a, q.adjust), adjustedPriority(b, q.adjust))
+}
+
+func adjustedPriority(rt *RTInfo, adjust map[int64]int) uint32 {
+	p := int64(rt.Priority) + int64(adjust[rt.Iface])
+	return uint32(min(max(p, 0), math.MaxUint32))
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sort"
+	"testing"
+)
+
+// benchSizes are the route counts lookups are benchmarked at.
+var benchSizes = []int{10, 1000, 100000}
+
+// benchIface returns the interface the benchmark routes go via, on
+// 10.0.0.0/8.
+func benchIface() *Interface {
+	return &Interface{Id: 0, Name: "eth0", addrs: []*InterfaceAddress{
+		{IP: net.IPv4(10, 0, 0, 2).To4(), Netmask: net.CIDRMask(8, 32)},
+	}}
+}
+
+// benchPrefixes returns n pseudo-random prefixes of 10.0.0.0/8, of lengths
+// 16 to 28, the same ones on every call.
+func benchPrefixes(n int) []*net.IPNet {
+	rng := rand.New(rand.NewPCG(1, uint64(n)))
+	nets := make([]*net.IPNet, n)
+	for i := range nets {
+		ones := 16 + rng.IntN(13)
+		ip := net.IPv4(10, byte(rng.UintN(256)), byte(rng.UintN(256)), byte(rng.UintN(256))).To4()
+		mask := net.CIDRMask(ones, 32)
+		nets[i] = &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+	}
+	return nets
+}
+
+// benchDsts returns n pseudo-random destinations in 10.0.0.0/8.
+func benchDsts(n int) []net.IP {
+	rng := rand.New(rand.NewPCG(2, uint64(n)))
+	dsts := make([]net.IP, n)
+	for i := range dsts {
+		dsts[i] = net.IPv4(10, byte(rng.UintN(256)), byte(rng.UintN(256)), byte(rng.UintN(256))).To4()
+	}
+	return dsts
+}
+
+// benchRouter returns a router built with opts holding a default route and
+// routes to benchPrefixes(n), all via benchIface. The prefixes are appended
+// and sorted in one go, since adding them one by one would make building the
+// larger tables quadratic.
+func benchRouter(b *testing.B, n int, opts ...Option) *Router {
+	b.Helper()
+	r := NewRouter(opts...)
+	iface := benchIface()
+	if err := r.AddRoutes(0, &Route{iface: iface, Dst: "default"}); err != nil {
+		b.Fatal(err)
+	}
+	f := &r.main.v4
+	for _, dst := range benchPrefixes(n) {
+		f.routes = append(f.routes, &RTInfo{Dst: dst, Selector: FirstAddressSelector, Iface: iface.Id, Weight: 1})
+	}
+	f.rebuild()
+	return r
+}
+
+// benchRoutes returns routes via iface to benchPrefixes(n), for the
+// benchmarks that install routes through AddRoutes.
+func benchRoutes(iface *Interface, n int) []*Route {
+	routes := make([]*Route, n)
+	for i, dst := range benchPrefixes(n) {
+		routes[i] = &Route{iface: iface, Dst: dst.String(), Priority: uint32(i % 16)}
+	}
+	return routes
+}
+
+func BenchmarkAddRoutes(b *testing.B) {
+	for _, n := range []int{10, 1000, 10000} {
+		routes := benchRoutes(benchIface(), n)
+		b.Run(fmt.Sprintf("routes=%d", n), func(b *testing.B) {
+			for b.Loop() {
+				if err := NewRouter().AddRoutes(0, routes...); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkUpdate measures Update re-sorting a table whose priorities were
+// all changed in place, and Update on a table already in order.
+func BenchmarkUpdate(b *testing.B) {
+	for _, n := range benchSizes {
+		r := benchRouter(b, n)
+		routes := r.V4Route()
+		b.Run(fmt.Sprintf("resort/routes=%d", n), func(b *testing.B) {
+			for i := 0; b.Loop(); i++ {
+				b.StopTimer()
+				for j, rt := range routes {
+					rt.Priority = uint32((i + j) % 7)
+				}
+				b.StartTimer()
+				r.Update()
+			}
+		})
+		b.Run(fmt.Sprintf("sorted/routes=%d", n), func(b *testing.B) {
+			for b.Loop() {
+				r.Update()
+			}
+		})
+	}
+}
+
+// BenchmarkRouteWithSrc measures RouteWithSrc without a lookup cache, and
+// with one of 256 entries for hot destinations, a few that stay cached, and
+// cold ones, too many to stay cached.
+func BenchmarkRouteWithSrc(b *testing.B) {
+	cases := []struct {
+		name  string
+		opts  []Option
+		ndsts int
+	}{
+		{"uncached", nil, 1024},
+		{"hot", []Option{WithLookupCache(256)}, 64},
+		{"cold", []Option{WithLookupCache(256)}, 65536},
+	}
+	for _, n := range benchSizes {
+		for _, c := range cases {
+			r := benchRouter(b, n, c.opts...)
+			dsts := benchDsts(c.ndsts)
+			b.Run(fmt.Sprintf("%s/routes=%d", c.name, n), func(b *testing.B) {
+				for i := 0; b.Loop(); i++ {
+					if _, _, _, err := r.RouteWithSrc(nil, dsts[i%len(dsts)]); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// scanRoutes is the lookup the trie replaced: the first route in lookup
+// order that contains dst.
+func scanRoutes(routes routeSlice, dst net.IP) *RTInfo {
+	for _, rt := range routes {
+		if rt.Dst.Contains(dst) {
+			return rt
+		}
+	}
+	return nil
+}
+
+func BenchmarkLookupTrieVsScan(b *testing.B) {
+	dsts := benchDsts(1024)
+	for _, n := range benchSizes {
+		r := benchRouter(b, n)
+		b.Run(fmt.Sprintf("trie/routes=%d", n), func(b *testing.B) {
+			for i := 0; b.Loop(); i++ {
+				if _, err := r.Lookup(nil, dsts[i%len(dsts)]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("scan/routes=%d", n), func(b *testing.B) {
+			for i := 0; b.Loop(); i++ {
+				if scanRoutes(r.main.v4.routes, dsts[i%len(dsts)]) == nil {
+					b.Fatal("no route")
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkInsert10k adds 10k routes one at a time, keeping the slice in
+// order by binary-search insertion as AddRoute does, against appending and
+// re-sorting the whole slice after each route as Update used to.
+func BenchmarkInsert10k(b *testing.B) {
+	var routes []*RTInfo
+	for _, dst := range benchPrefixes(10000) {
+		routes = append(routes, &RTInfo{Dst: dst, Selector: FirstAddressSelector, Weight: 1})
+	}
+	b.Run("incremental", func(b *testing.B) {
+		for b.Loop() {
+			var f routeFamily
+			for _, rt := range routes {
+				f.add(rt)
+			}
+		}
+	})
+	b.Run("resort", func(b *testing.B) {
+		for b.Loop() {
+			var s routeSlice
+			for _, rt := range routes {
+				s = append(s, rt)
+				sort.Sort(s)
+			}
+		}
+	})
+}
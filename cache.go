@@ -0,0 +1,93 @@
+package main
+
+import (
+	"container/list"
+	"net"
+	"sync"
+)
+
+// WithLookupCache puts an LRU cache of up to size (src, dst) pairs in front of
+// route matching. Any change to the table empties it, so it never returns a
+// stale decision. Lookups that find no route are not cached, nor are those
+// with a zone, a scope or a flow protocol.
+func WithLookupCache(size int) Option {
+	return func(r *Router) {
+		if size > 0 {
+			r.cache = newLookupCache(size)
+		} else {
+			r.cache = nil
+		}
+	}
+}
+
+type cacheKey struct {
+	table    int
+	src, dst [net.IPv6len]byte
+	hasSrc   bool
+}
+
+func makeCacheKey(table int, q query) cacheKey {
+	k := cacheKey{table: table}
+	copy(k.dst[:], q.dst.To16())
+	if src16 := q.src.To16(); src16 != nil {
+		copy(k.src[:], src16)
+		k.hasSrc = true
+	}
+	return k
+}
+
+type cacheEntry struct {
+	key cacheKey
+	rt  *RTInfo
+}
+
+// lookupCache is an LRU map from cacheKey to the winning route. It has its
+// own lock because lookups fill it while holding only the router's read lock.
+type lookupCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // front is most recently used
+	items map[cacheKey]*list.Element
+}
+
+func newLookupCache(size int) *lookupCache {
+	return &lookupCache{
+		size:  size,
+		order: list.New(),
+		items: make(map[cacheKey]*list.Element, size),
+	}
+}
+
+func (c *lookupCache) get(k cacheKey) (*RTInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[k]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*cacheEntry).rt, true
+}
+
+func (c *lookupCache) put(k cacheKey, rt *RTInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[k]; ok {
+		e.Value.(*cacheEntry).rt = rt
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[k] = c.order.PushFront(&cacheEntry{key: k, rt: rt})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *lookupCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	clear(c.items)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"sync/atomic"
+)
+
+// Clone returns an independent copy of the router for what-if changes: its
+// interfaces, addresses, routes and rules are copied, so mutating either
+// router leaves the other alone. Selectors, Metrics and Logger are shared,
+// and a lookup cache is recreated empty with the same size.
+func (r *Router) Clone() *Router {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c := &Router{
+		ifaces: make(map[int64]*Interface, len(r.ifaces)),
+		tables: make(map[int]*table, len(r.tables)),
+		rules:  slices.Clone(r.rules),
+
+		special:         r.special,
+		defaultSelector: r.defaultSelector,
+		metrics:         r.metrics,
+		less:            r.less,
+		logger:          r.logger,
+		hash:            r.hash,
+		lastResort:      r.lastResort,
+		hasLastResort:   r.hasLastResort,
+		connected:       r.connected,
+	}
+	for id, iface := range r.ifaces {
+		c.ifaces[id] = iface.clone()
+	}
+	c.reindexNames()
+	for id, t := range r.tables {
+		c.tables[id] = &table{id: id, v4: t.v4.clone(), v6: t.v6.clone()}
+	}
+	c.main = c.tables[MainTable]
+	if r.cache != nil {
+		c.cache = newLookupCache(r.cache.size)
+	}
+	return c
+}
+
+func (i *Interface) clone() *Interface {
+	c := &Interface{Id: i.Id, Name: i.Name, MTU: i.MTU, down: i.down}
+	for _, a := range i.addrs {
+		c.addrs = append(c.addrs, &InterfaceAddress{
+			IP:         slices.Clone(a.IP),
+			Netmask:    slices.Clone(a.Netmask),
+			Broadaddr:  slices.Clone(a.Broadaddr),
+			Gateway:    slices.Clone(a.Gateway),
+			Zone:       a.Zone,
+			Deprecated: a.Deprecated,
+			Tentative:  a.Tentative,
+		})
+	}
+	return c
+}
+
+// clone copies the routes, keeping both the slice and the trie in their
+// current order so that lookups, including ECMP picks, behave the same.
+func (f *routeFamily) clone() routeFamily {
+	copies := make(map[*RTInfo]*RTInfo, len(f.routes))
+	c := routeFamily{routes: make(routeSlice, len(f.routes))}
+	for i, rt := range f.routes {
+		c.routes[i] = rt.clone()
+		copies[rt] = c.routes[i]
+	}
+	c.trie = *f.trie.clone(copies)
+	return c
+}
+
+func (n *trieNode) clone(copies map[*RTInfo]*RTInfo) *trieNode {
+	c := &trieNode{routes: make(routeSlice, len(n.routes))}
+	for i, rt := range n.routes {
+		c.routes[i] = copies[rt]
+	}
+	for b, child := range n.child {
+		if child != nil {
+			c.child[b] = child.clone(copies)
+		}
+	}
+	return c
+}
+
+// clone copies rt, reading its hit counter atomically since lookups may be
+// updating it.
+func (rt *RTInfo) clone() *RTInfo {
+	return &RTInfo{
+		Src:           rt.Src,
+		Dst:           rt.Dst,
+		Selector:      rt.Selector,
+		SelectorName:  rt.SelectorName,
+		Priority:      rt.Priority,
+		AdminDistance: rt.AdminDistance,
+		Iface:         rt.Iface,
+		NextHop:       rt.NextHop,
+		Type:          rt.Type,
+		Expiry:        rt.Expiry,
+		Weight:        rt.Weight,
+		Onlink:        rt.Onlink,
+		Scope:         rt.Scope,
+		Proto:         rt.Proto,
+		DstPorts:      rt.DstPorts,
+		Mark:          rt.Mark,
+		Labels:        maps.Clone(rt.Labels),
+		Connected:     rt.Connected,
+		hits:          atomic.LoadUint64(&rt.hits),
+	}
+}
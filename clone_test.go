@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestCloneMutationLeavesOriginal(t *testing.T) {
+	r := NewRouter()
+	eth0 := testIface(t, 0, "eth0", "192.168.1.2/24")
+	if err := r.AddRoutes(0,
+		&Route{iface: eth0, Dst: "default", NextHop: "192.168.1.1"},
+		&Route{iface: eth0, Dst: "10.0.0.0/8", Priority: 5},
+		&Route{iface: testIface(t, 1, "eth1", "2001:db8::2/64"), Dst: "2001:db8::/32"},
+	); err != nil {
+		t.Fatal(err)
+	}
+	before, table := r.TableHash(), r.FormatTable()
+
+	c := r.Clone()
+	if c.TableHash() != before {
+		t.Fatal("clone differs from the original")
+	}
+	c.V4Route()[0].Priority = 99
+	c.Update()
+	c.Interfaces()[0].addrs[0].IP[3] = 9
+	if err := c.Interfaces()[0].AddAddress(&InterfaceAddress{IP: net.ParseIP("192.168.2.2").To4(), Netmask: net.CIDRMask(24, 32)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetInterfaceState(1, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddRoutes(0, &Route{iface: c.Interfaces()[0], Dst: "172.16.0.0/12"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := c.RemoveRoute(&net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}); n != 1 {
+		t.Fatalf("RemoveRoute on the clone removed %d routes, want 1", n)
+	}
+	if c.TableHash() == before {
+		t.Fatal("mutations did not change the clone")
+	}
+
+	if r.TableHash() != before || r.FormatTable() != table {
+		t.Errorf("mutating the clone changed the original:\n%s\nwant:\n%s", r.FormatTable(), table)
+	}
+	if eth0.addrs[0].IP.String() != "192.168.1.2" || len(eth0.addrs) != 1 {
+		t.Errorf("original interface addresses changed to %v", eth0.addrs)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import "fmt"
+
+// ConflictKind says how the two routes of a Conflict overlap.
+type ConflictKind uint8
+
+const (
+	// Shadowed: one route's destination contains the other's, via a
+	// different interface, so the more specific one takes part of its range.
+	Shadowed ConflictKind = iota
+	// Duplicate: both routes have the same destination and source but
+	// different interfaces.
+	Duplicate
+)
+
+func (k ConflictKind) String() string {
+	if k == Duplicate {
+		return "duplicate"
+	}
+	return "shadowed"
+}
+
+// Conflict is a pair of main table routes that overlap via different
+// interfaces. Winner is the route lookups prefer where both match and Reason
+// the part of the lookup order that decides it.
+type Conflict struct {
+	Kind          ConflictKind
+	Winner, Loser *RTInfo
+	Reason        string
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%v: %v via %d wins over %v via %d (%s)",
+		c.Kind, c.Winner.Dst, c.Winner.Iface, c.Loser.Dst, c.Loser.Iface, c.Reason)
+}
+
+// Conflicts lints the main table for routes that overlap via different
+// interfaces: a destination contained in another's, or the same destination
+// and source listed twice. Default routes contain every other route and are
+// not reported as shadowed. Nothing is changed; the conflicts are listed in
+// table order, IPv4 before IPv6.
+func (r *Router) Conflicts() []Conflict {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []Conflict
+	for _, f := range []*routeFamily{&r.main.v4, &r.main.v6} {
+		for i, rt := range f.routes {
+			for _, other := range f.routes[i+1:] {
+				if other.Iface != rt.Iface && samePrefix(other.Dst, rt.Dst) && sameSrc(other, rt) && sameFlowMatch(other, rt) {
+					out = append(out, r.conflict(Duplicate, rt, other))
+				}
+			}
+			ones := prefixLen(rt.Dst)
+			f.trie.match(rt.Dst.IP, func(other *RTInfo) bool {
+				if o := prefixLen(other.Dst); o < ones && o > 0 && other.Iface != rt.Iface {
+					out = append(out, r.conflict(Shadowed, rt, other))
+				}
+				return true
+			})
+		}
+	}
+	return out
+}
+
+func (r *Router) conflict(kind ConflictKind, a, b *RTInfo) Conflict {
+	less := routeLess
+	if r.less != nil {
+		less = r.less
+	}
+	if less(b, a) {
+		a, b = b, a
+	}
+	return Conflict{Kind: kind, Winner: a, Loser: b, Reason: r.conflictReason(a, b)}
+}
+
+// conflictReason describes why w is ordered before l.
+func (r *Router) conflictReason(w, l *RTInfo) string {
+	switch {
+	case r.less != nil:
+		if r.sameCost(w, l) {
+			return "equal cost, flows are split between them"
+		}
+		return "ordered first by the comparator"
+	case prefixLen(w.Dst) != prefixLen(l.Dst):
+		return fmt.Sprintf("longer prefix /%d over /%d", prefixLen(w.Dst), prefixLen(l.Dst))
+	case srcBits(w) != srcBits(l):
+		return fmt.Sprintf("longer source prefix /%d over /%d", srcBits(w), srcBits(l))
+	case w.AdminDistance != l.AdminDistance:
+		return fmt.Sprintf("lower administrative distance %d over %d", w.AdminDistance, l.AdminDistance)
+	case w.Priority != l.Priority:
+		return fmt.Sprintf("lower priority %d over %d", w.Priority, l.Priority)
+	}
+	return "equal cost, flows are split between them"
+}
+
+// sameFlowMatch reports whether a and b match the same flows.
+func sameFlowMatch(a, b *RTInfo) bool {
+	return a.Proto == b.Proto && a.DstPorts == b.DstPorts && a.Mark == b.Mark
+}
+
+// sameSrc reports whether a and b match the same sources.
+func sameSrc(a, b *RTInfo) bool {
+	if srcBits(a) == 0 && srcBits(b) == 0 {
+		return true
+	}
+	return samePrefix(a.Src, b.Src)
+}
@@ -0,0 +1,55 @@
+package main
+
+// WithConnectedRoutes makes the router install a connected route for the
+// subnet of each address of an interface when the interface is registered,
+// by AddInterface or by the first route via it, as kernels do. Connected
+// routes are on-link, link-scope routes in the main table with priority 0
+// and FitAddressSelector, marked Connected. Registering the interface again
+// replaces its connected routes to match its current addresses.
+func WithConnectedRoutes() Option {
+	return func(r *Router) {
+		r.connected = true
+	}
+}
+
+// addConnected replaces the connected routes of iface with one per distinct
+// subnet of its addresses, if the router installs connected routes.
+func (r *Router) addConnected(iface *Interface) {
+	if !r.connected {
+		return
+	}
+	n := 0
+	for _, f := range []*routeFamily{&r.main.v4, &r.main.v6} {
+		n += r.removeRoutes(r.main, f, func(rt *RTInfo) bool { return rt.Connected && rt.Iface == iface.Id })
+	}
+	var added []*RTInfo
+	seen := make(map[string]bool)
+	for _, a := range iface.addrs {
+		dst := normalizeNet(a.Network())
+		if dst == nil || prefixLen(dst) == 0 || seen[dst.String()] {
+			continue // no subnet, or another address on the same one
+		}
+		seen[dst.String()] = true
+		rt := &RTInfo{
+			Dst:       dst,
+			Selector:  FitAddressSelector,
+			Iface:     iface.Id,
+			Weight:    1,
+			Onlink:    true,
+			Scope:     ScopeLink,
+			Connected: true,
+		}
+		r.main.familyOfNet(dst).add(rt)
+		added = append(added, rt)
+	}
+	if n == 0 && len(added) == 0 {
+		return
+	}
+	r.routesChanged()
+	for _, rt := range added {
+		r.emit(Event{Type: RouteAdded, Table: MainTable, Route: rt})
+	}
+	if r.logger != nil {
+		r.logger.Infof("table %d: interface %d: %d connected routes", MainTable, iface.Id, len(added))
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestConnectedRoutesSurviveReload(t *testing.T) {
+	dst := net.ParseIP("10.0.0.5")
+	connected := func(t *testing.T, r *Router) {
+		t.Helper()
+		rt, err := r.Lookup(nil, dst)
+		if err != nil || !rt.Connected || rt.Dst.String() != "10.0.0.0/8" {
+			t.Errorf("Lookup(%v) = %v, %v, want the connected 10.0.0.0/8", dst, rt, err)
+		}
+		if n := r.LenV4(); n != 2 {
+			t.Errorf("LenV4() = %d, want the connected and the default route", n)
+		}
+	}
+	setup := func(t *testing.T) (*Router, *Interface) {
+		t.Helper()
+		r := NewRouter(WithConnectedRoutes())
+		iface := testIface(t, 0, "eth0", "10.0.0.2/8")
+		if err := r.AddInterface(iface); err != nil {
+			t.Fatal(err)
+		}
+		return r, iface
+	}
+
+	t.Run("ClearRoutes", func(t *testing.T) {
+		r, iface := setup(t)
+		r.ClearRoutes()
+		if err := r.AddRoutes(0, &Route{iface: iface, Dst: "default", NextHop: "10.0.0.1"}); err != nil {
+			t.Fatal(err)
+		}
+		connected(t, r)
+	})
+	t.Run("SwapRoutes", func(t *testing.T) {
+		r, _ := setup(t)
+		snapshot := r.V4Route() // its connected route is not installed twice
+		def := &RTInfo{Dst: anyPrefix(net.IPv4len), Selector: FirstAddressSelector, NextHop: net.ParseIP("10.0.0.1")}
+		if err := r.SwapRoutes(append(snapshot, def), nil); err != nil {
+			t.Fatal(err)
+		}
+		connected(t, r)
+		if err := r.SwapRoutes(nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		if rt, err := r.Lookup(nil, dst); err != nil || !rt.Connected || r.LenV4() != 1 {
+			t.Errorf("after swapping in no routes: Lookup(%v) = %v, %v with %d routes", dst, rt, err, r.LenV4())
+		}
+	})
+}
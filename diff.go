@@ -0,0 +1,139 @@
+package main
+
+import (
+	"maps"
+	"reflect"
+	"sort"
+)
+
+// RouteDiff lists what changed between two routers' main tables. Routes are
+// matched on Dst and Iface; a matched pair that differs in any other field is
+// Modified. The routes and interfaces are the routers' own, not copies.
+type RouteDiff struct {
+	Added, Removed                     []*RTInfo
+	Modified                           []RouteChange
+	AddedInterfaces, RemovedInterfaces []*Interface // matched on Id
+}
+
+// RouteChange is a route present in both routers with different settings.
+type RouteChange struct {
+	Old, New *RTInfo
+}
+
+// Empty reports whether the routers compared equal.
+func (d *RouteDiff) Empty() bool {
+	return len(d.Added)+len(d.Removed)+len(d.Modified)+len(d.AddedInterfaces)+len(d.RemovedInterfaces) == 0
+}
+
+// Diff compares old to updated, e.g. a live router to a reloaded
+// configuration, so that only the differences need to be applied. Several
+// routes sharing a Dst and Iface, as in an ECMP group, are matched up in
+// lookup order.
+func Diff(old, updated *Router) *RouteDiff {
+	oldRoutes, oldIfaces := old.diffSnapshot()
+	newRoutes, newIfaces := updated.diffSnapshot()
+
+	d := &RouteDiff{}
+	for _, id := range sortedIfaceIDs(newIfaces) {
+		if oldIfaces[id] == nil {
+			d.AddedInterfaces = append(d.AddedInterfaces, newIfaces[id])
+		}
+	}
+	for _, id := range sortedIfaceIDs(oldIfaces) {
+		if newIfaces[id] == nil {
+			d.RemovedInterfaces = append(d.RemovedInterfaces, oldIfaces[id])
+		}
+	}
+
+	byKey := make(map[diffKey][]*RTInfo)
+	for _, rt := range oldRoutes {
+		k := makeDiffKey(rt)
+		byKey[k] = append(byKey[k], rt)
+	}
+	for _, rt := range newRoutes {
+		k := makeDiffKey(rt)
+		olds := byKey[k]
+		if len(olds) == 0 {
+			d.Added = append(d.Added, rt)
+			continue
+		}
+		if !sameSettings(olds[0], rt) {
+			d.Modified = append(d.Modified, RouteChange{Old: olds[0], New: rt})
+		}
+		byKey[k] = olds[1:]
+	}
+	for _, rt := range oldRoutes {
+		k := makeDiffKey(rt)
+		if olds := byKey[k]; len(olds) > 0 && olds[0] == rt {
+			d.Removed = append(d.Removed, rt)
+			byKey[k] = olds[1:]
+		}
+	}
+	return d
+}
+
+// diffSnapshot returns the main table's routes, IPv4 first, and a copy of
+// the interface map.
+func (r *Router) diffSnapshot() ([]*RTInfo, map[int64]*Interface) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	routes := make([]*RTInfo, 0, len(r.main.v4.routes)+len(r.main.v6.routes))
+	routes = append(append(routes, r.main.v4.routes...), r.main.v6.routes...)
+	ifaces := make(map[int64]*Interface, len(r.ifaces))
+	for id, iface := range r.ifaces {
+		ifaces[id] = iface
+	}
+	return routes, ifaces
+}
+
+type diffKey struct {
+	dst   string
+	iface int64
+}
+
+func makeDiffKey(rt *RTInfo) diffKey {
+	return diffKey{dst: rt.Dst.String(), iface: rt.Iface}
+}
+
+// sameSettings reports whether a and b, which share a diffKey, are
+// configured the same.
+func sameSettings(a, b *RTInfo) bool {
+	return samePrefix(a.Src, b.Src) &&
+		a.Priority == b.Priority &&
+		a.AdminDistance == b.AdminDistance &&
+		sameSelector(a.Selector, b.Selector) && sameSelectorName(a, b) &&
+		a.NextHop.Equal(b.NextHop) &&
+		a.Type == b.Type &&
+		a.Weight == b.Weight &&
+		a.Onlink == b.Onlink &&
+		a.Scope == b.Scope &&
+		a.Proto == b.Proto &&
+		a.DstPorts == b.DstPorts &&
+		a.Mark == b.Mark &&
+		maps.Equal(a.Labels, b.Labels) &&
+		a.Connected == b.Connected
+}
+
+// sameSelectorName compares the names the routes' selectors are marshaled
+// under, so that a route read back from JSON equals the original.
+func sameSelectorName(a, b *RTInfo) bool {
+	aName, _ := selectorName(a)
+	bName, _ := selectorName(b)
+	return aName == bName
+}
+
+func sameSelector(a, b InterfaceAddressSelector) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+}
+
+func sortedIfaceIDs(ifaces map[int64]*Interface) []int64 {
+	ids := make([]int64, 0, len(ifaces))
+	for id := range ifaces {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// WriteDOT writes the main table as a Graphviz digraph: a box per interface
+// and an edge per route, labeled with its destination and priority, to an
+// ellipse for its gateway or, for an on-link route, to a note for the
+// destination itself. Gateways are found as in FormatTable. Only unicast
+// routes are drawn: blackhole, unreachable and prohibit routes forward
+// nothing, even when installed via an interface.
+func (r *Router) WriteDOT(w io.Writer) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph routes {")
+	fmt.Fprintln(bw, "\trankdir=LR;")
+	for _, id := range sortedIfaceIDs(r.ifaces) {
+		iface := r.ifaces[id]
+		fmt.Fprintf(bw, "\t%s [shape=box, label=%s];\n", dotIfaceNode(id), strconv.Quote(iface.Name))
+	}
+	nodes := make(map[string]bool)
+	for _, routes := range []routeSlice{r.main.v4.routes, r.main.v6.routes} {
+		for _, rt := range routes {
+			iface := r.ifaces[rt.Iface]
+			if iface == nil || rt.Type != RouteUnicast {
+				continue
+			}
+			var node, shape, label string
+			if nh := r.tableNextHop(rt, iface); nh.OnLink {
+				node, shape, label = "dst "+rt.Dst.String(), "note", rt.Dst.String()
+			} else {
+				node, shape, label = "gw "+nh.Gateway.String(), "ellipse", nh.Gateway.String()
+			}
+			if !nodes[node] {
+				nodes[node] = true
+				fmt.Fprintf(bw, "\t%s [shape=%s, label=%s];\n", strconv.Quote(node), shape, strconv.Quote(label))
+			}
+			edge := fmt.Sprintf("%v\npriority %d", rt.Dst, rt.Priority)
+			fmt.Fprintf(bw, "\t%s -> %s [label=%s];\n", dotIfaceNode(rt.Iface), strconv.Quote(node), strconv.Quote(edge))
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+func dotIfaceNode(id int64) string {
+	return strconv.Quote(fmt.Sprintf("iface %d", id))
+}
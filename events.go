@@ -0,0 +1,106 @@
+package main
+
+import "fmt"
+
+// EventType says what an Event reports.
+type EventType uint8
+
+const (
+	RouteAdded EventType = iota
+	RouteRemoved
+	InterfaceUp
+	InterfaceDown
+)
+
+var eventTypeNames = []string{"route-added", "route-removed", "interface-up", "interface-down"}
+
+func (t EventType) String() string {
+	if int(t) < len(eventTypeNames) {
+		return eventTypeNames[t]
+	}
+	return fmt.Sprintf("EventType(%d)", t)
+}
+
+// Event is a change to the router. Route events carry the route and its
+// table; interface events carry the interface.
+type Event struct {
+	Type      EventType
+	Table     int
+	Route     *RTInfo
+	Interface *Interface
+}
+
+// eventBuffer is how many events a subscriber may fall behind by before the
+// oldest are dropped.
+const eventBuffer = 64
+
+// Subscribe returns a channel receiving every later change. Mutations never
+// wait for a subscriber: once it falls eventBuffer events behind, its oldest
+// pending events are dropped to make room.
+func (r *Router) Subscribe() <-chan Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ch := make(chan Event, eventBuffer)
+	r.subs = append(r.subs, ch)
+	return ch
+}
+
+// Unsubscribe stops and closes a channel returned by Subscribe.
+func (r *Router) Unsubscribe(ch <-chan Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, sub := range r.subs {
+		if sub == ch {
+			r.subs = append(r.subs[:i], r.subs[i+1:]...)
+			close(sub)
+			return
+		}
+	}
+}
+
+// emit sends ev to every subscriber, dropping a full subscriber's oldest
+// event. It must be called with the write lock held.
+func (r *Router) emit(ev Event) {
+	for _, ch := range r.subs {
+		for {
+			select {
+			case ch <- ev:
+			default:
+				select {
+				case <-ch:
+				default:
+				}
+				continue
+			}
+			break
+		}
+	}
+}
+
+// removeRoutes is f.removeFunc, emitting RouteRemoved for every route
+// removed from table t.
+func (r *Router) removeRoutes(t *table, f *routeFamily, fn func(*RTInfo) bool) int {
+	return f.removeFunc(func(rt *RTInfo) bool {
+		if !fn(rt) {
+			return false
+		}
+		r.emit(Event{Type: RouteRemoved, Table: t.id, Route: rt})
+		return true
+	})
+}
+
+// emitRemovedAll emits RouteRemoved for every route, before the tables are
+// cleared.
+func (r *Router) emitRemovedAll() {
+	if len(r.subs) == 0 {
+		return
+	}
+	for _, id := range r.tableIDs() {
+		t := r.tables[id]
+		for _, routes := range []routeSlice{t.v4.routes, t.v6.routes} {
+			for _, rt := range routes {
+				r.emit(Event{Type: RouteRemoved, Table: id, Route: rt})
+			}
+		}
+	}
+}
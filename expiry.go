@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// ExpireStale removes the routes, in all tables, whose Expiry is at or
+// before now and returns how many were removed. Lookups already ignore
+// expired routes; ExpireStale reclaims them.
+func (r *Router) ExpireStale(now time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, t := range r.tables {
+		for _, f := range []*routeFamily{&t.v4, &t.v6} {
+			n += r.removeRoutes(t, f, func(rt *RTInfo) bool { return !rt.Expiry.IsZero() && !now.Before(rt.Expiry) })
+		}
+	}
+	if n > 0 {
+		r.routesChanged()
+		if r.logger != nil {
+			r.logger.Infof("expired %d routes", n)
+		}
+	}
+	return n
+}
+
+// RunExpiry calls ExpireStale every interval until ctx is done. It blocks, so
+// run it in its own goroutine.
+func (r *Router) RunExpiry(ctx context.Context, interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-tick.C:
+			r.ExpireStale(now)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// TraceStep is one candidate route considered during a lookup.
+type TraceStep struct {
+	Route     *RTInfo
+	PrefixLen int
+	Priority  uint32
+	Winner    bool
+}
+
+// Trace lists every route whose Src and Dst contain the looked-up pair, in
+// the order the router evaluates them. The winner is the first step unless
+// the best routes form an ECMP group, in which case it is the member picked
+// for this flow.
+type Trace struct {
+	Src, Dst net.IP
+	Steps    []TraceStep
+}
+
+// Winner returns the route the lookup picked, or nil if nothing matched.
+func (t *Trace) Winner() *RTInfo {
+	for _, s := range t.Steps {
+		if s.Winner {
+			return s.Route
+		}
+	}
+	return nil
+}
+
+func (t *Trace) String() string {
+	strs := []string{fmt.Sprintf("TRACE %v -> %v", t.Src, t.Dst)}
+	for i, s := range t.Steps {
+		mark := " "
+		if s.Winner {
+			mark = "*"
+		}
+		strs = append(strs, fmt.Sprintf("%s %d: %v /%d priority %d iface %d", mark, i, s.Route.Dst, s.PrefixLen, s.Priority, s.Route.Iface))
+	}
+	if len(t.Steps) == 0 {
+		strs = append(strs, "  no route found")
+	}
+	return strings.Join(strs, "\n")
+}
+
+// Explain performs the same matching as Lookup but records every candidate
+// instead of stopping at the first. It does not modify the router.
+func (r *Router) Explain(src, dst net.IP) (*Trace, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	winner, err := r.bestMatch(r.main, query{src: src, dst: dst})
+	if err != nil {
+		return nil, err
+	}
+	t := &Trace{Src: src, Dst: dst}
+	r.candidates(r.main, query{src: src, dst: dst}, func(rt *RTInfo) bool {
+		ones, _ := rt.Dst.Mask.Size()
+		t.Steps = append(t.Steps, TraceStep{
+			Route:     rt,
+			PrefixLen: ones,
+			Priority:  rt.Priority,
+			Winner:    rt == winner,
+		})
+		return true
+	})
+	return t, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// FormatTable renders the main table as aligned columns, IPv4 routes first.
+// The gateway is the route's NextHop, or else what the route's address
+// selector gives for its destination network: the address's Gateway or
+// on-link. Non-unicast routes show their type instead.
+func (r *Router) FormatTable() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "Destination\tPriority\tInterface\tGateway")
+	for _, routes := range []routeSlice{r.main.v4.routes, r.main.v6.routes} {
+		for _, rt := range routes {
+			name, gateway := "-", rt.Type.String()
+			if iface := r.ifaces[rt.Iface]; iface != nil {
+				name = iface.Name
+				if rt.Type == RouteUnicast {
+					gateway = r.tableGateway(rt, iface)
+				}
+			}
+			fmt.Fprintf(w, "%v\t%d\t%s\t%s\n", rt.Dst, rt.Priority, name, gateway)
+		}
+	}
+	w.Flush()
+	return b.String()
+}
+
+// FormatResolved renders the main table like FormatTable, one section per
+// family, but resolves each unicast route as RouteWithSrc would for its
+// destination network address: the Interface and Gateway columns then show
+// the actual egress interface and next hop after any recursive next hop
+// resolution, and Address the source address picked. A route that does not
+// resolve shows the error instead.
+func (r *Router) FormatResolved() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 8, 2, ' ', 0)
+	for _, f := range []struct {
+		name   string
+		routes routeSlice
+	}{{"IPv4", r.main.v4.routes}, {"IPv6", r.main.v6.routes}} {
+		fmt.Fprintf(w, "--- %s ---\n", f.name)
+		fmt.Fprintln(w, "Destination\tSource\tPriority\tInterface\tGateway\tAddress")
+		for _, rt := range f.routes {
+			src := "any"
+			var srcIP net.IP
+			if rt.Src != nil {
+				src, srcIP = rt.Src.String(), rt.Src.IP
+			}
+			name, gateway, addr := "-", rt.Type.String(), "-"
+			if rt.Type == RouteUnicast {
+				res, err := r.resolveRoute(context.Background(), r.main, rt, query{src: srcIP, dst: rt.Dst.IP}, 0)
+				if err != nil {
+					gateway = "error: " + err.Error()
+				} else {
+					name, gateway = res.iface.Name, res.nextHop.String()
+					if res.addr != nil {
+						addr = res.addr.IP.String()
+					}
+				}
+			}
+			fmt.Fprintf(w, "%v\t%s\t%d\t%s\t%s\t%s\n", rt.Dst, src, rt.Priority, name, gateway, addr)
+		}
+	}
+	w.Flush()
+	return b.String()
+}
+
+func (r *Router) tableGateway(rt *RTInfo, iface *Interface) string {
+	return r.tableNextHop(rt, iface).String()
+}
+
+func (r *Router) tableNextHop(rt *RTInfo, iface *Interface) NextHop {
+	addr := r.selectorOf(rt)(iface.Addresses(), nil, rt.Dst.IP)
+	return chooseNextHop(rt, addr, rt.Dst.IP)
+}
+
+// WriteCSV writes the main table as CSV with a header row and the columns
+// Destination, Source, Priority, Interface, Gateway and Family, filled in as
+// by FormatTable. Rows are sorted by family, destination address, prefix
+// length, source, priority and interface so that exports of equal tables are
+// identical.
+func (r *Router) WriteCSV(w io.Writer) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	type row struct {
+		rt     *RTInfo
+		fields []string
+	}
+	var rows []row
+	for _, f := range []struct {
+		name   string
+		routes routeSlice
+	}{{"ipv4", r.main.v4.routes}, {"ipv6", r.main.v6.routes}} {
+		start := len(rows)
+		for _, rt := range f.routes {
+			name, gateway := "", rt.Type.String()
+			if iface := r.ifaces[rt.Iface]; iface != nil {
+				name = iface.Name
+				if rt.Type == RouteUnicast {
+					gateway = r.tableGateway(rt, iface)
+				}
+			}
+			src := ""
+			if rt.Src != nil {
+				src = rt.Src.String()
+			}
+			rows = append(rows, row{rt, []string{rt.Dst.String(), src, strconv.FormatUint(uint64(rt.Priority), 10), name, gateway, f.name}})
+		}
+		family := rows[start:]
+		sort.SliceStable(family, func(i, j int) bool {
+			a, b := family[i], family[j]
+			if c := bytes.Compare(a.rt.Dst.IP, b.rt.Dst.IP); c != 0 {
+				return c < 0
+			}
+			if aOnes, bOnes := prefixLen(a.rt.Dst), prefixLen(b.rt.Dst); aOnes != bOnes {
+				return aOnes < bOnes
+			}
+			if a.fields[1] != b.fields[1] {
+				return a.fields[1] < b.fields[1]
+			}
+			if a.rt.Priority != b.rt.Priority {
+				return a.rt.Priority < b.rt.Priority
+			}
+			return a.fields[3] < b.fields[3]
+		})
+	}
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"Destination", "Source", "Priority", "Interface", "Gateway", "Family"})
+	for _, row := range rows {
+		cw.Write(row.fields)
+	}
+	cw.Flush()
+	return cw.Error()
+}
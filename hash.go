@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"reflect"
+	"slices"
+	"time"
+)
+
+// TableHash returns a fingerprint of the router's interfaces, routes and
+// rules, so that a consumer can skip reprocessing a router that has not
+// changed. Routers with the same contents hash the same whatever order their
+// routes were added in; the order of interface addresses and of rules of
+// equal priority does count, since it affects lookups. Hit counts are left
+// out. A selector without a name, see RegisterSelector, is identified by its
+// code address, which is only stable within one process.
+func (r *Router) TableHash() uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	h := fnv.New64a()
+	for _, id := range sortedIfaceIDs(r.ifaces) {
+		iface := r.ifaces[id]
+		fmt.Fprintf(h, "iface %d %q %d %t\n", iface.Id, iface.Name, iface.MTU, iface.down)
+		for _, a := range iface.addrs {
+			fmt.Fprintf(h, "addr %v %v %v %v %q %t %t\n", a.IP, a.Netmask, a.Broadaddr, a.Gateway, a.Zone, a.Deprecated, a.Tentative)
+		}
+	}
+	for _, id := range r.tableIDs() {
+		t := r.tables[id]
+		lines := make([]string, 0, len(t.v4.routes)+len(t.v6.routes))
+		for _, rt := range append(slices.Clone(t.v4.routes), t.v6.routes...) {
+			lines = append(lines, hashLine(rt))
+		}
+		if len(lines) == 0 {
+			continue // an empty table looks up like a missing one
+		}
+		slices.Sort(lines)
+		fmt.Fprintf(h, "table %d %d\n", id, len(lines))
+		for _, line := range lines {
+			io.WriteString(h, line)
+		}
+	}
+	for _, ru := range r.rules {
+		fmt.Fprintf(h, "rule %d %v %d %d %d\n", ru.Priority, ru.Src, ru.Mark, ru.MarkMask, ru.Table)
+	}
+	return h.Sum64()
+}
+
+// hashLine writes every field of rt but its hit count as one line.
+func hashLine(rt *RTInfo) string {
+	sel := rt.SelectorName
+	if sel == "" && rt.Selector != nil {
+		var ok bool
+		if sel, ok = nameOfSelector(rt.Selector); !ok {
+			sel = fmt.Sprintf("%#x", reflect.ValueOf(rt.Selector).Pointer())
+		}
+	}
+	expiry := ""
+	if !rt.Expiry.IsZero() {
+		expiry = rt.Expiry.UTC().Format(time.RFC3339Nano)
+	}
+	return fmt.Sprintf("route %v %v %q %d %d %d %v %d %d %t %d %d %v %d %q %v %t\n",
+		rt.Src, rt.Dst, sel, rt.Priority, rt.AdminDistance, rt.Iface, rt.NextHop,
+		rt.Type, rt.Weight, rt.Onlink, rt.Scope, rt.Proto, rt.DstPorts, rt.Mark, expiry, rt.Labels, rt.Connected)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+)
+
+// lookupJSON is the body of a successful /lookup.
+type lookupJSON struct {
+	Interface string `json:"interface"`
+	Address   string `json:"address,omitempty"`
+	Gateway   string `json:"gateway,omitempty"` // empty when on-link
+	OnLink    bool   `json:"onLink"`
+	Prefix    string `json:"prefix,omitempty"` // empty for the default interface
+	MTU       int    `json:"mtu"`
+}
+
+type errorJSON struct {
+	Error string `json:"error"`
+}
+
+// Handler serves the router for debugging:
+//
+//   - GET /lookup?src=...&dst=... resolves dst, and optionally src, like
+//     RouteAddr and returns the interface, selected address, gateway,
+//     matched prefix and path MTU; a destination without a usable route is
+//     a 404;
+//   - GET /routes returns the whole router as marshaled by MarshalJSON.
+//
+// Errors are returned as {"error": "..."}.
+func (r *Router) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/lookup", getOnly(r.serveLookup))
+	mux.HandleFunc("/routes", getOnly(r.serveRoutes))
+	return mux
+}
+
+func getOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeJSON(w, http.StatusMethodNotAllowed, errorJSON{"method not allowed"})
+			return
+		}
+		h(w, req)
+	}
+}
+
+func (r *Router) serveLookup(w http.ResponseWriter, req *http.Request) {
+	dst, err := netip.ParseAddr(req.FormValue("dst"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorJSON{fmt.Sprintf("invalid dst: %v", err)})
+		return
+	}
+	src := netip.IPv6Unspecified() // a missing src is any source of dst's family
+	if dst.Unmap().Is4() {
+		src = netip.IPv4Unspecified()
+	}
+	if s := req.FormValue("src"); s != "" {
+		if src, err = netip.ParseAddr(s); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorJSON{fmt.Sprintf("invalid src: %v", err)})
+			return
+		}
+	}
+	q := query{src: addrToIP(nil, src), dst: addrToIP(nil, dst), zone: dst.Zone()}
+	r.mu.RLock()
+	res, err := r.resolve(req.Context(), r.main, q, 0)
+	r.mu.RUnlock()
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrNoRoute) || errors.Is(err, ErrBlackhole) || errors.Is(err, ErrUnreachable) || errors.Is(err, ErrRejected) || errors.Is(err, ErrMulticast) {
+			status = http.StatusNotFound
+		}
+		writeJSON(w, status, errorJSON{err.Error()})
+		return
+	}
+	out := lookupJSON{Interface: res.iface.Name, OnLink: res.nextHop.OnLink, MTU: res.mtu}
+	if res.addr != nil {
+		out.Address = res.addr.IP.String()
+	}
+	if res.nextHop.Gateway != nil {
+		out.Gateway = res.nextHop.Gateway.String()
+	}
+	if res.rt != nil {
+		out.Prefix = res.rt.Dst.String()
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (r *Router) serveRoutes(w http.ResponseWriter, req *http.Request) {
+	data, err := r.MarshalJSON()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorJSON{err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,101 @@
+package main
+
+import "net"
+
+// AddInterface registers iface, with its addresses, without adding any route
+// via it. An interface already registered under the same Id is replaced, and
+// the routes via that Id then egress through iface. An interface that fails
+// Validate is not registered.
+func (r *Router) AddInterface(iface *Interface) error {
+	if err := iface.Validate(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.setInterface(iface)
+	r.addConnected(iface)
+	r.routesChanged()
+	return nil
+}
+
+// InterfaceByName returns the interface with the given name. If several
+// share the name, the one registered last wins.
+func (r *Router) InterfaceByName(name string) (*Interface, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	iface, ok := r.byName[name]
+	return iface, ok
+}
+
+// InterfaceForAddress returns the interface that owns ip, along with the
+// address: preferably one equal to ip, else the one with the longest subnet
+// containing ip. Ties go to the lowest interface Id, then to the address
+// listed first. Down interfaces count too. An IPv4-mapped ip is taken as IPv4.
+func (r *Router) InterfaceForAddress(ip net.IP) (*Interface, *InterfaceAddress, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var bestIface *Interface
+	var best *InterfaceAddress
+	bestOnes, bestExact := -1, false
+	for _, id := range sortedIfaceIDs(r.ifaces) {
+		iface := r.ifaces[id]
+		for _, a := range iface.addrs {
+			if !a.Contains(ip) {
+				continue
+			}
+			ones, _ := a.Network().Mask.Size()
+			exact := a.IP.Equal(ip)
+			if exact && !bestExact || exact == bestExact && ones > bestOnes {
+				bestIface, best, bestOnes, bestExact = iface, a, ones, exact
+			}
+		}
+	}
+	return bestIface, best, best != nil
+}
+
+// setInterface stores iface under its Id, replacing any interface with that
+// Id, and indexes it by name. Re-setting an interface picks up a change of
+// its Name.
+func (r *Router) setInterface(iface *Interface) {
+	if old := r.ifaces[iface.Id]; old != nil {
+		r.unindexName(old)
+	}
+	r.ifaces[iface.Id] = iface
+	if iface.Name != "" {
+		r.byName[iface.Name] = iface
+	}
+}
+
+func (r *Router) deleteInterface(id int64) {
+	if old := r.ifaces[id]; old != nil {
+		delete(r.ifaces, id)
+		r.unindexName(old)
+	}
+}
+
+// unindexName drops iface from the name index, falling back to another
+// interface of the same name if there is one.
+func (r *Router) unindexName(iface *Interface) {
+	for name, indexed := range r.byName {
+		if indexed != iface {
+			continue
+		}
+		delete(r.byName, name)
+		for _, other := range r.ifaces {
+			if other != iface && other.Name == name {
+				r.byName[name] = other
+				break
+			}
+		}
+	}
+}
+
+// reindexNames rebuilds the name index from ifaces.
+func (r *Router) reindexNames() {
+	r.byName = make(map[string]*Interface, len(r.ifaces))
+	for _, iface := range r.ifaces {
+		if iface.Name != "" {
+			r.byName[iface.Name] = iface
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ipRouteValueKeys are the `ip route` keywords followed by a value. Any other
+// keyword is taken as a flag.
+var ipRouteValueKeys = map[string]bool{
+	"via": true, "dev": true, "metric": true, "src": true, "from": true,
+	"proto": true, "scope": true, "table": true, "pref": true, "expires": true,
+	"mtu": true, "weight": true, "realm": true, "hoplimit": true, "advmss": true,
+	"initcwnd": true, "initrwnd": true, "features": true, "quickack": true,
+	"congctl": true, "rtt": true, "rttvar": true, "ssthresh": true, "cwnd": true,
+	"window": true, "reordering": true, "nhid": true, "tos": true, "dsfield": true,
+	"mtu_lock": true, "fastopen_no_cookie": true,
+}
+
+// ipRouteLine is one route of `ip route` output, split into its destination
+// and keyword arguments. A multipath route has one nexthop per hop.
+type ipRouteLine struct {
+	typ      string
+	dst      string
+	args     map[string]string
+	nexthops []map[string]string
+}
+
+// ParseIPRoute builds a Router from the text output of `ip -4 route` and/or
+// `ip -6 route`, e.g. "172.16.1.0/24 via 10.0.0.1 dev eth1 metric 100".
+// Interfaces are created per dev, numbered in order of appearance; the src
+// of a link-scope route is recorded as an address of its interface. Each hop
+// of a multipath route becomes its own route, keeping its weight and onlink
+// flag. Only unicast, blackhole, unreachable and prohibit routes are
+// imported, each into the table named by its table keyword or the main table
+// if there is none.
+func ParseIPRoute(rd io.Reader) (*Router, error) {
+	var lines []*ipRouteLine
+	sc := bufio.NewScanner(rd)
+	for n := 1; sc.Scan(); n++ {
+		text := sc.Text()
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "nexthop" {
+			if len(lines) == 0 || text[0] != ' ' && text[0] != '\t' {
+				return nil, fmt.Errorf("line %d: nexthop outside a multipath route", n)
+			}
+			last := lines[len(lines)-1]
+			last.nexthops = append(last.nexthops, ipRouteArgs(fields[1:]))
+			continue
+		}
+		line := &ipRouteLine{typ: "unicast"}
+		switch fields[0] {
+		case "unicast", "local", "broadcast", "multicast", "throw", "unreachable", "prohibit", "blackhole", "nat", "anycast":
+			line.typ, fields = fields[0], fields[1:]
+		}
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("line %d: missing destination", n)
+		}
+		line.dst, line.args = fields[0], ipRouteArgs(fields[1:])
+		lines = append(lines, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	r := NewRouter()
+	ifaces := make(map[string]*Interface)
+	ifaceFor := func(name string) *Interface {
+		if ifaces[name] == nil {
+			ifaces[name] = &Interface{Id: int64(len(ifaces)), Name: name}
+		}
+		return ifaces[name]
+	}
+	for _, line := range lines {
+		typ, ok := ipRouteTypes[line.typ]
+		if !ok {
+			continue
+		}
+		t, err := r.ipRouteTable(line.args["table"])
+		if err != nil {
+			return nil, fmt.Errorf("route %q: %w", line.dst, err)
+		}
+		if typ != RouteUnicast {
+			route, err := line.route(nil, "")
+			if err != nil {
+				return nil, fmt.Errorf("route %q: %w", line.dst, err)
+			}
+			route.Type = typ
+			if _, err := r.addRoute(t, 0, route); err != nil {
+				return nil, fmt.Errorf("route %q: %w", line.dst, err)
+			}
+			continue
+		}
+		hops := line.nexthops
+		if len(hops) == 0 {
+			hops = []map[string]string{line.args}
+		}
+		for _, hop := range hops {
+			if hop["dev"] == "" {
+				return nil, fmt.Errorf("route %q: missing dev", line.dst)
+			}
+			route, err := line.route(ifaceFor(hop["dev"]), hop["via"])
+			if err != nil {
+				return nil, fmt.Errorf("route %q: %w", line.dst, err)
+			}
+			if _, ok := hop["onlink"]; ok {
+				route.Onlink = true
+			}
+			if w, ok := hop["weight"]; ok {
+				weight, err := strconv.ParseUint(w, 10, 32)
+				if err != nil {
+					return nil, fmt.Errorf("route %q: invalid weight %q", line.dst, w)
+				}
+				route.Weight = uint32(weight)
+			}
+			if _, err := r.addRoute(t, 0, route); err != nil {
+				return nil, fmt.Errorf("route %q: %w", line.dst, err)
+			}
+			if line.args["scope"] == "link" && line.args["src"] != "" {
+				if err := addLinkAddress(route.iface, route.DstNet(), line.args["src"]); err != nil {
+					return nil, fmt.Errorf("route %q: %w", line.dst, err)
+				}
+			}
+		}
+	}
+	return r, nil
+}
+
+// ipRouteTypes maps the route types ParseIPRoute imports.
+var ipRouteTypes = map[string]RouteType{
+	"unicast":     RouteUnicast,
+	"blackhole":   RouteBlackhole,
+	"unreachable": RouteUnreachable,
+	"prohibit":    RouteProhibit,
+}
+
+// ipRouteTableIds maps the table names iproute2 reserves to their ids.
+var ipRouteTableIds = map[string]int{
+	"":        MainTable,
+	"main":    MainTable,
+	"default": 253,
+	"local":   255,
+}
+
+// ipRouteTable returns the table named by a table keyword, creating it if
+// needed.
+func (r *Router) ipRouteTable(name string) (*table, error) {
+	id, ok := ipRouteTableIds[name]
+	if !ok {
+		n, err := strconv.ParseUint(name, 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("invalid table %q", name)
+		}
+		id = int(n)
+	}
+	if r.tables[id] == nil {
+		r.tables[id] = &table{id: id}
+	}
+	return r.tables[id], nil
+}
+
+func ipRouteArgs(fields []string) map[string]string {
+	args := make(map[string]string)
+	for i := 0; i < len(fields); i++ {
+		if ipRouteValueKeys[fields[i]] && i+1 < len(fields) {
+			args[fields[i]] = fields[i+1]
+			i++
+		} else {
+			args[fields[i]] = ""
+		}
+	}
+	return args
+}
+
+// route converts the line to a Route via gateway on iface. "default" is
+// resolved from the addresses on the line, since the interfaces built by
+// ParseIPRoute have no addresses to infer the family from, or failing that
+// from the pref keyword, which only `ip -6 route` prints.
+func (l *ipRouteLine) route(iface *Interface, via string) (*Route, error) {
+	_, onlink := l.args["onlink"]
+	route := &Route{iface: iface, Dst: l.dst, Src: l.args["from"], NextHop: via, Onlink: onlink}
+	if l.dst == "default" {
+		route.Dst = "0.0.0.0/0"
+		if _, pref := l.args["pref"]; pref || strings.Contains(via+l.args["src"]+l.args["from"], ":") {
+			route.Dst = "::/0"
+		}
+	}
+	if s, ok := l.args["scope"]; ok {
+		route.Scope, _ = parseScope(s) // other scopes are imported as global
+	}
+	if m, ok := l.args["metric"]; ok {
+		metric, err := strconv.ParseUint(m, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metric %q", m)
+		}
+		route.Priority = uint32(metric)
+	}
+	if via != "" && net.ParseIP(via) == nil {
+		return nil, fmt.Errorf("invalid gateway %q", via)
+	}
+	return route, nil
+}
+
+// addLinkAddress records src as an address of iface on the subnet n, unless
+// iface already has it.
+func addLinkAddress(iface *Interface, n *net.IPNet, src string) error {
+	ip := net.ParseIP(src)
+	if ip == nil {
+		return fmt.Errorf("invalid src %q", src)
+	}
+	for _, a := range iface.addrs {
+		if a.IP.Equal(ip) {
+			return nil
+		}
+	}
+	return iface.AddAddress(&InterfaceAddress{IP: ip, Netmask: n.Mask})
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// selectorName returns the name rt's selector is written to JSON under: the
+// one it was installed by, else that of a built-in selector.
+func selectorName(rt *RTInfo) (string, error) {
+	if rt.SelectorName != "" || rt.Selector == nil {
+		return rt.SelectorName, nil
+	}
+	if name, ok := nameOfSelector(rt.Selector); ok {
+		return name, nil
+	}
+	return "", fmt.Errorf("selector %p has no name", rt.Selector)
+}
+
+// routerJSON holds the main table at the top level and any other table
+// under Tables.
+type routerJSON struct {
+	Interfaces []interfaceJSON `json:"interfaces"`
+	V4         []rtInfoJSON    `json:"v4"`
+	V6         []rtInfoJSON    `json:"v6"`
+	Tables     []tableJSON     `json:"tables,omitempty"`
+	Rules      []ruleJSON      `json:"rules,omitempty"`
+}
+
+type tableJSON struct {
+	Id int          `json:"id"`
+	V4 []rtInfoJSON `json:"v4"`
+	V6 []rtInfoJSON `json:"v6"`
+}
+
+type ruleJSON struct {
+	Priority uint32 `json:"priority"`
+	Src      string `json:"src,omitempty"`
+	Mark     uint32 `json:"mark,omitempty"`
+	MarkMask uint32 `json:"markMask,omitempty"`
+	Table    int    `json:"table"`
+}
+
+type interfaceJSON struct {
+	Id        int64                  `json:"id"`
+	Name      string                 `json:"name"`
+	MTU       int                    `json:"mtu,omitempty"`
+	Down      bool                   `json:"down,omitempty"`
+	Addresses []interfaceAddressJSON `json:"addresses,omitempty"`
+}
+
+type interfaceAddressJSON struct {
+	IP         net.IP `json:"ip"`
+	Netmask    string `json:"netmask,omitempty"`
+	Broadaddr  net.IP `json:"broadaddr,omitempty"`
+	Gateway    net.IP `json:"gateway,omitempty"`
+	Zone       string `json:"zone,omitempty"`
+	Deprecated bool   `json:"deprecated,omitempty"`
+	Tentative  bool   `json:"tentative,omitempty"`
+}
+
+type rtInfoJSON struct {
+	Src           string            `json:"src,omitempty"`
+	Dst           string            `json:"dst"`
+	Selector      string            `json:"selector,omitempty"`
+	Priority      uint32            `json:"priority"`
+	AdminDistance uint32            `json:"adminDistance,omitempty"`
+	Iface         int64             `json:"iface"`
+	NextHop       net.IP            `json:"nextHop,omitempty"`
+	Type          string            `json:"type,omitempty"`
+	Expiry        time.Time         `json:"expiry,omitzero"`
+	Weight        uint32            `json:"weight,omitempty"` // omitted when 1
+	Onlink        bool              `json:"onlink,omitempty"`
+	Scope         string            `json:"scope,omitempty"` // omitted when global
+	Proto         uint8             `json:"proto,omitempty"`
+	DstPorts      string            `json:"dstPorts,omitempty"` // e.g. "443" or "8000-8080"
+	Mark          uint32            `json:"mark,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	Connected     bool              `json:"connected,omitempty"`
+}
+
+// MarshalJSON writes the interfaces, ordered by Id, and the routes of every
+// table in lookup order, followed by the rules. Selectors are written by
+// name, see RegisterSelector, so a route using a selector other than the
+// built-in ones must have been given it by SelectorName.
+func (r *Router) MarshalJSON() ([]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out routerJSON
+	for _, iface := range r.ifaces {
+		ij := interfaceJSON{Id: iface.Id, Name: iface.Name, MTU: iface.MTU, Down: iface.down}
+		for _, a := range iface.addrs {
+			ij.Addresses = append(ij.Addresses, interfaceAddressJSON{
+				IP:         a.IP,
+				Netmask:    maskString(a.Netmask),
+				Broadaddr:  a.Broadaddr,
+				Gateway:    a.Gateway,
+				Zone:       a.Zone,
+				Deprecated: a.Deprecated,
+				Tentative:  a.Tentative,
+			})
+		}
+		out.Interfaces = append(out.Interfaces, ij)
+	}
+	sort.Slice(out.Interfaces, func(i, j int) bool { return out.Interfaces[i].Id < out.Interfaces[j].Id })
+	for _, id := range r.tableIDs() {
+		t := r.tables[id]
+		v4, err := routesToJSON(t.v4.routes)
+		if err != nil {
+			return nil, err
+		}
+		v6, err := routesToJSON(t.v6.routes)
+		if err != nil {
+			return nil, err
+		}
+		if id == MainTable {
+			out.V4, out.V6 = v4, v6
+		} else {
+			out.Tables = append(out.Tables, tableJSON{Id: id, V4: v4, V6: v6})
+		}
+	}
+	for _, ru := range r.rules {
+		rj := ruleJSON{Priority: ru.Priority, Mark: ru.Mark, MarkMask: ru.MarkMask, Table: ru.Table}
+		if ru.Src != nil {
+			rj.Src = ru.Src.String()
+		}
+		out.Rules = append(out.Rules, rj)
+	}
+	return json.Marshal(out)
+}
+
+func routesToJSON(routes routeSlice) ([]rtInfoJSON, error) {
+	out := make([]rtInfoJSON, 0, len(routes))
+	for _, rt := range routes {
+		name, err := selectorName(rt)
+		if err != nil {
+			return nil, fmt.Errorf("route %v: %w", rt.Dst, err)
+		}
+		rj := rtInfoJSON{
+			Dst:           rt.Dst.String(),
+			Selector:      name,
+			Priority:      rt.Priority,
+			AdminDistance: rt.AdminDistance,
+			Iface:         rt.Iface,
+			NextHop:       rt.NextHop,
+			Expiry:        rt.Expiry,
+			Onlink:        rt.Onlink,
+			Proto:         rt.Proto,
+			Mark:          rt.Mark,
+			Labels:        rt.Labels,
+			Connected:     rt.Connected,
+		}
+		if rt.Src != nil {
+			rj.Src = rt.Src.String()
+		}
+		if rt.Type != RouteUnicast {
+			rj.Type = rt.Type.String()
+		}
+		if rt.Scope != ScopeGlobal {
+			rj.Scope = rt.Scope.String()
+		}
+		if rt.Weight != 1 {
+			rj.Weight = rt.Weight
+		}
+		if !rt.DstPorts.any() {
+			rj.DstPorts = rt.DstPorts.String()
+		}
+		out = append(out, rj)
+	}
+	return out, nil
+}
+
+// UnmarshalJSON replaces the router's contents with tables written by
+// MarshalJSON. Every route must reference one of the listed interfaces.
+func (r *Router) UnmarshalJSON(data []byte) error {
+	var in routerJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	ifaces := make(map[int64]*Interface, len(in.Interfaces))
+	for _, ij := range in.Interfaces {
+		iface := &Interface{Id: ij.Id, Name: ij.Name, MTU: ij.MTU, down: ij.Down}
+		for _, aj := range ij.Addresses {
+			mask, err := parseMask(aj.Netmask)
+			if err != nil {
+				return fmt.Errorf("interface %d: %w", ij.Id, err)
+			}
+			iface.addrs = append(iface.addrs, &InterfaceAddress{
+				IP:         aj.IP,
+				Netmask:    mask,
+				Broadaddr:  aj.Broadaddr,
+				Gateway:    aj.Gateway,
+				Zone:       aj.Zone,
+				Deprecated: aj.Deprecated,
+				Tentative:  aj.Tentative,
+			})
+		}
+		ifaces[ij.Id] = iface
+	}
+	tables := make(map[int]*table)
+	for _, tj := range append([]tableJSON{{Id: MainTable, V4: in.V4, V6: in.V6}}, in.Tables...) {
+		t := tables[tj.Id]
+		if t == nil {
+			t = &table{id: tj.Id}
+			tables[tj.Id] = t
+		}
+		for _, rj := range append(tj.V4, tj.V6...) {
+			rt, err := rtInfoFromJSON(rj)
+			if err != nil {
+				return fmt.Errorf("route %q: %w", rj.Dst, err)
+			}
+			if ifaces[rt.Iface] == nil && (rt.Type == RouteUnicast || rt.Iface != NoInterface) {
+				return fmt.Errorf("route %q: unknown interface %d", rj.Dst, rt.Iface)
+			}
+			f := t.familyOfNet(rt.Dst)
+			f.routes = append(f.routes, rt)
+		}
+		t.v4.rebuild()
+		t.v6.rebuild()
+	}
+	var rules []Rule
+	for _, rj := range in.Rules {
+		ru := Rule{Priority: rj.Priority, Mark: rj.Mark, MarkMask: rj.MarkMask, Table: rj.Table}
+		if rj.Src != "" {
+			var err error
+			if ru.Src, err = parsePrefix(rj.Src); err != nil {
+				return fmt.Errorf("rule %d: invalid source: %w", rj.Priority, err)
+			}
+		}
+		rules = append(rules, ru)
+	}
+	sort.SliceStable(rules, func(i, j int) bool { return rules[i].Priority < rules[j].Priority })
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ifaces, r.tables, r.main, r.rules = ifaces, tables, tables[MainTable], rules
+	r.reindexNames()
+	r.routesChanged()
+	return nil
+}
+
+func rtInfoFromJSON(rj rtInfoJSON) (*RTInfo, error) {
+	rt := &RTInfo{Priority: rj.Priority, AdminDistance: rj.AdminDistance, Iface: rj.Iface, NextHop: rj.NextHop, Expiry: rj.Expiry, Weight: max(rj.Weight, 1), Onlink: rj.Onlink, Proto: rj.Proto, Mark: rj.Mark, Labels: rj.Labels, Connected: rj.Connected}
+	var err error
+	if rj.Src != "" {
+		if rt.Src, err = parsePrefix(rj.Src); err != nil {
+			return nil, fmt.Errorf("invalid source: %w", err)
+		}
+	}
+	if rt.Dst, err = parsePrefix(rj.Dst); err != nil {
+		return nil, fmt.Errorf("invalid destination: %w", err)
+	}
+	if rj.Type != "" {
+		if rt.Type, err = parseRouteType(rj.Type); err != nil {
+			return nil, err
+		}
+	}
+	if rj.Scope != "" {
+		if rt.Scope, err = parseScope(rj.Scope); err != nil {
+			return nil, err
+		}
+	}
+	if rj.DstPorts != "" {
+		if rt.DstPorts, err = parsePortRange(rj.DstPorts); err != nil {
+			return nil, err
+		}
+	}
+	if rj.Selector != "" {
+		var ok bool
+		if rt.Selector, ok = LookupSelector(rj.Selector); !ok {
+			return nil, fmt.Errorf("unknown selector %q", rj.Selector)
+		}
+		rt.SelectorName = rj.Selector
+	}
+	return rt, nil
+}
+
+func parseRouteType(s string) (RouteType, error) {
+	for i, name := range routeTypeNames {
+		if name == s {
+			return RouteType(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown route type %q", s)
+}
+
+// maskString writes a mask in address notation, e.g. 255.255.255.0 or
+// ffff:ffff:ffff:ffff::.
+func maskString(m net.IPMask) string {
+	if m == nil {
+		return ""
+	}
+	return net.IP(m).String()
+}
+
+func parseMask(s string) (net.IPMask, error) {
+	if s == "" {
+		return nil, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid netmask %q", s)
+	}
+	if !strings.Contains(s, ":") {
+		ip = ip.To4()
+	}
+	return net.IPMask(ip), nil
+}
@@ -0,0 +1,45 @@
+package main
+
+// WithDefaultInterface is SetDefaultInterface at construction.
+func WithDefaultInterface(id int64) Option {
+	return func(r *Router) {
+		r.lastResort, r.hasLastResort = id, true
+	}
+}
+
+// SetDefaultInterface makes the interface with the given id the gateway of
+// last resort: when RouteWithSrc, RouteWithNextHop or RouteAddr find no route
+// for a destination, they egress through it instead of failing with
+// ErrNoRoute, using its address picked by the default selector and that
+// address's Gateway as next hop. Blackhole and unreachable routes still
+// fail, as does a lookup while the interface is down or missing.
+func (r *Router) SetDefaultInterface(id int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastResort, r.hasLastResort = id, true
+}
+
+// ClearDefaultInterface undoes SetDefaultInterface.
+func (r *Router) ClearDefaultInterface() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hasLastResort = false
+}
+
+// resolveLastResort resolves q through the default interface, reporting
+// whether there is one to use.
+func (r *Router) resolveLastResort(q query) (resolution, bool) {
+	if !r.hasLastResort {
+		return resolution{}, false
+	}
+	iface := r.ifaces[r.lastResort]
+	if iface == nil || iface.down {
+		return resolution{}, false
+	}
+	sel := r.defaultSelector
+	if sel == nil {
+		sel = FirstAddressSelector
+	}
+	addr := sel(iface.Addresses(), q.src, q.dst)
+	return resolution{iface: iface, addr: addr, nextHop: chooseNextHop(&RTInfo{}, addr, q.dst), mtu: iface.EffectiveMTU()}, true
+}
@@ -0,0 +1,16 @@
+package main
+
+// Logger receives the router's log messages: Infof for route changes and
+// Debugf for lookup misses and Update. Implementations must be safe for
+// concurrent use. Without a Logger nothing is formatted.
+type Logger interface {
+	Debugf(format string, args ...any)
+	Infof(format string, args ...any)
+}
+
+// WithLogger sends the router's log messages to l.
+func WithLogger(l Logger) Option {
+	return func(r *Router) {
+		r.logger = l
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+)
+
+// Merge copies the interfaces and the routes of every table of other into r,
+// adding priorityOffset to the priority of each copied route so that either
+// source can be made to win ties. An interface of other whose Id is already
+// taken in r is renumbered, in increasing order of Id, past the largest Id of
+// both routers, and the routes via it follow it. Merge returns the Ids it
+// changed, keyed by other's Id. The rules of other are not copied. Under
+// WithConnectedRoutes, r installs its own connected routes for the copied
+// interfaces in place of other's.
+func (r *Router) Merge(other *Router, priorityOffset uint32) map[int64]int64 {
+	o := other.Clone() // other may be r, so do not hold both locks
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var renumbered map[int64]int64
+	next := int64(0)
+	for id := range r.ifaces {
+		next = max(next, id+1)
+	}
+	for id := range o.ifaces {
+		next = max(next, id+1)
+	}
+	for _, id := range slices.Sorted(maps.Keys(o.ifaces)) {
+		iface := o.ifaces[id]
+		if r.ifaces[id] != nil {
+			if renumbered == nil {
+				renumbered = make(map[int64]int64)
+			}
+			renumbered[id], iface.Id = next, next
+			next++
+		}
+		r.setInterface(iface)
+		r.addConnected(iface)
+	}
+
+	for _, id := range o.tableIDs() {
+		t := r.tables[id]
+		if t == nil {
+			t = &table{id: id}
+			r.tables[id] = t
+		}
+		for _, f := range []*routeFamily{&o.tables[id].v4, &o.tables[id].v6} {
+			for _, rt := range f.routes {
+				if rt.Connected && r.connected && id == MainTable {
+					continue // installed by addConnected above
+				}
+				if newId, ok := renumbered[rt.Iface]; ok {
+					rt.Iface = newId
+				}
+				rt.Priority = uint32(min(uint64(rt.Priority)+uint64(priorityOffset), math.MaxUint32))
+				t.familyOfNet(rt.Dst).add(rt)
+				r.emit(Event{Type: RouteAdded, Table: id, Route: rt})
+			}
+		}
+	}
+	r.routesChanged()
+	if r.logger != nil {
+		r.logger.Infof("merged %d interfaces, %d renumbered", len(o.ifaces), len(renumbered))
+	}
+	return renumbered
+}
+
+// AddRoutesWithIfaceMap is AddRoutes for routes built against another set of
+// interfaces, such as those of another Router. A route via an interface
+// whose Id is a key of ifaceMap is installed via the interface of r with the
+// mapped Id instead, leaving r's interface as it is; the route itself is not
+// modified. A mapped Id that r does not know makes the route invalid. Routes
+// via unmapped interfaces are installed as by AddRoutes.
+func (r *Router) AddRoutesWithIfaceMap(ifaceMap map[int64]int64, priority uint32, routes ...*Route) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	for i, route := range routes {
+		if route.iface != nil {
+			if id, ok := ifaceMap[route.iface.Id]; ok {
+				target := r.ifaces[id]
+				if target == nil {
+					errs = append(errs, fmt.Errorf("route %d (dst %q): interface %d maps to unknown interface %d", i, route.Dst, route.iface.Id, id))
+					continue
+				}
+				mapped := *route
+				mapped.iface = target
+				route = &mapped
+			}
+		}
+		if _, err := r.addRoute(r.main, priority, route); err != nil {
+			errs = append(errs, fmt.Errorf("route %d (dst %q): %w", i, route.Dst, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net"
+	"time"
+)
+
+// Address families as reported to Metrics.
+const (
+	FamilyV4 = 4
+	FamilyV6 = 6
+)
+
+// Metrics receives one observation per lookup. It is the hook for exporting
+// lookup counters: an implementation backed by Prometheus would count lookups
+// and misses in counter vectors labeled by family and interface name, observe
+// latency in a histogram, and be registered with the caller's own registry.
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	// ObserveLookup reports a lookup for an address of family. iface is the
+	// interface of the winning route, or nil on a miss.
+	ObserveLookup(family int, iface *Interface, miss bool, latency time.Duration)
+}
+
+// WithMetrics is SetMetrics at construction.
+func WithMetrics(m Metrics) Option {
+	return func(r *Router) {
+		r.metrics = m
+	}
+}
+
+// SetMetrics attaches m to the router, or detaches the current one when m is
+// nil. Without Metrics, lookups do not even read the clock.
+func (r *Router) SetMetrics(m Metrics) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = m
+}
+
+func (r *Router) observeLookup(start time.Time, dst net.IP, rt *RTInfo) {
+	family := FamilyV6
+	if dst.To4() != nil {
+		family = FamilyV4
+	}
+	var iface *Interface
+	if rt != nil {
+		iface = r.ifaces[rt.Iface]
+	}
+	r.metrics.ObserveLookup(family, iface, rt == nil, time.Since(start))
+}
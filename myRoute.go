@@ -1,47 +1,310 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"iter"
+	"maps"
 	"net"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Interface struct {
 	Id    int64
 	Name  string
+	MTU   int // 0 means DefaultMTU
 	addrs []*InterfaceAddress
+	down  bool // see Router.SetInterfaceState
+}
+
+// DefaultMTU is the MTU of an Interface that does not set one.
+const DefaultMTU = 1500
+
+// EffectiveMTU returns the interface's MTU, or DefaultMTU if it is unset.
+func (i *Interface) EffectiveMTU() int {
+	if i.MTU <= 0 {
+		return DefaultMTU
+	}
+	return i.MTU
+}
+
+// InZone reports whether zone, as in fe80::1%eth0, names the interface:
+// either its Name or the Zone of one of its addresses.
+func (i *Interface) InZone(zone string) bool {
+	if i.Name == zone {
+		return true
+	}
+	for _, a := range i.addrs {
+		if a.Zone == zone {
+			return true
+		}
+	}
+	return false
 }
 
 func (i *Interface) Addresses() []*InterfaceAddress {
 	return i.addrs
 }
 
+// Up reports whether the interface is administratively up. Interfaces start
+// up.
+func (i *Interface) Up() bool {
+	return !i.down
+}
+
+// Route describes a route to install. Src and Dst each take a CIDR prefix, a
+// bare address for a host route, or the keyword "default" for the any-prefix
+// of the route's family (0.0.0.0/0 or ::/0). The family of "default" follows
+// the other prefix when that one is concrete; otherwise it is IPv6 only when
+// every address on the interface is IPv6.
 type Route struct {
 	iface    *Interface
 	Src      string
 	Dst      string
 	Priority uint32
-	NextHop  string // Added for NextHop
+	// AdminDistance ranks the source of the route, e.g. static before a
+	// routing protocol, ahead of Priority; lower wins.
+	AdminDistance uint32
+	NextHop       string    // Added for NextHop
+	Type          RouteType // non-unicast routes need no interface
+	Expiry        time.Time // zero never expires, see RTInfo.Expiry
+	Weight        uint32    // share among equal-cost routes; 0 means 1
+	// Onlink says the destination, or NextHop if set, is reachable directly
+	// on the interface even outside its subnets, as with Linux's onlink.
+	Onlink bool
+	Scope  Scope // ScopeGlobal unless set
+	// Proto and DstPorts, if set, limit the route to flows of that IP
+	// protocol and destination port, see LookupFlow; other lookups skip it.
+	// Likewise a nonzero Mark limits it to packets carrying that firewall
+	// mark.
+	Proto    uint8
+	DstPorts PortRange
+	Mark     uint32
+	// Labels are free-form bookkeeping, e.g. the origin or owner of the
+	// route. Lookups ignore them; they are copied into the RTInfo and kept
+	// by Clone and MarshalJSON.
+	Labels map[string]string
+	// AddressSelector picks the source address of lookups matching the
+	// route. It overrides the router's WithDefaultSelector; if both are nil
+	// FirstAddressSelector is used. SelectorName instead names a selector
+	// registered with RegisterSelector, and is kept for marshaling.
+	AddressSelector InterfaceAddressSelector
+	SelectorName    string
+}
+
+// RouteType says what happens to traffic whose best match is the route.
+type RouteType uint8
+
+const (
+	RouteUnicast     RouteType = iota // forward via the route's interface
+	RouteBlackhole                    // drop silently
+	RouteUnreachable                  // reject as unreachable
+	RouteProhibit                     // reject as administratively prohibited
+)
+
+var routeTypeNames = []string{"unicast", "blackhole", "unreachable", "prohibit"}
+
+func (t RouteType) String() string {
+	if int(t) < len(routeTypeNames) {
+		return routeTypeNames[t]
+	}
+	return fmt.Sprintf("RouteType(%d)", t)
+}
+
+// NoInterface is the RTInfo.Iface of a non-unicast route installed without
+// an interface.
+const NoInterface int64 = -1
+
+var (
+	ErrBlackhole   = errors.New("destination is blackholed")
+	ErrUnreachable = errors.New("destination is unreachable")
+	ErrRejected    = errors.New("destination is administratively prohibited")
+
+	// ErrNoRoute is returned, wrapped with the destination, by lookups that
+	// match no route.
+	ErrNoRoute = errors.New("no route found")
+	// ErrInvalidIP is returned for an address that is neither IPv4 nor IPv6.
+	ErrInvalidIP = errors.New("IP is not valid as IPv4 or IPv6")
+)
+
+// typeError returns the error a lookup reports when rt wins for dst, or nil
+// for a unicast route.
+func (rt *RTInfo) typeError(dst net.IP) error {
+	switch rt.Type {
+	case RouteBlackhole:
+		return fmt.Errorf("%w: %v", ErrBlackhole, dst)
+	case RouteUnreachable:
+		return fmt.Errorf("%w: %v", ErrUnreachable, dst)
+	case RouteProhibit:
+		return fmt.Errorf("%w: %v", ErrRejected, dst)
+	}
+	return nil
+}
+
+// NextHop describes how traffic leaves the selected interface: either
+// delivered directly on the attached subnet, or forwarded to Gateway.
+type NextHop struct {
+	OnLink  bool
+	Gateway net.IP // nil when OnLink
+}
+
+func (n NextHop) String() string {
+	if n.OnLink {
+		return "on-link"
+	}
+	return n.Gateway.String()
 }
 
 type InterfaceAddressSelector func([]*InterfaceAddress, net.IP, net.IP) *InterfaceAddress
 
-func (*Route) Selector() InterfaceAddressSelector {
+// Selector returns the route's AddressSelector, else the selector registered
+// under its SelectorName, else FirstAddressSelector.
+func (r *Route) Selector() InterfaceAddressSelector {
+	if r.AddressSelector != nil {
+		return r.AddressSelector
+	}
+	if sel, ok := LookupSelector(r.SelectorName); ok {
+		return sel
+	}
 	return FirstAddressSelector
 }
 
 func (r *Route) Interface() (*Interface, error) {
+	if r.iface == nil {
+		return nil, errors.New("route has no interface")
+	}
 	return r.iface, nil
 }
 func (r *Route) SrcNet() *net.IPNet {
-	_, n, _ := net.ParseCIDR(r.Src)
-	return n
+	src, _, _ := r.parse()
+	return src
 }
 func (r *Route) DstNet() *net.IPNet {
-	_, n, _ := net.ParseCIDR(r.Dst)
-	return n
+	_, dst, _ := r.parse()
+	return dst
+}
+
+// prepare returns what the route is installed with: its interface, which
+// only a unicast route needs, and its prefixes.
+func (r *Route) prepare() (iface *Interface, src, dst *net.IPNet, err error) {
+	iface, err = r.Interface()
+	if err != nil && r.Type == RouteUnicast {
+		return nil, nil, nil, err
+	}
+	src, dst, err = r.parse()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if r.DstPorts.Last < r.DstPorts.First {
+		return nil, nil, nil, fmt.Errorf("invalid destination ports %v", r.DstPorts)
+	}
+	if r.SelectorName != "" && r.AddressSelector == nil {
+		if _, ok := LookupSelector(r.SelectorName); !ok {
+			return nil, nil, nil, fmt.Errorf("unknown selector %q", r.SelectorName)
+		}
+	}
+	return iface, src, dst, nil
+}
+
+// parse validates the route's prefixes. An empty Src matches any source; Dst
+// is mandatory and must be of Src's family.
+func (r *Route) parse() (src, dst *net.IPNet, err error) {
+	if r.Src != "" && r.Src != "default" {
+		if src, err = parsePrefix(r.Src); err != nil {
+			return nil, nil, fmt.Errorf("invalid source: %w", err)
+		}
+	}
+	switch r.Dst {
+	case "":
+		return nil, nil, errors.New("missing destination")
+	case "default":
+		if src != nil {
+			dst = anyPrefix(len(src.IP))
+		} else {
+			dst = anyPrefix(r.defaultFamily())
+		}
+	default:
+		if dst, err = parsePrefix(r.Dst); err != nil {
+			return nil, nil, fmt.Errorf("invalid destination: %w", err)
+		}
+	}
+	if r.Src == "default" {
+		src = anyPrefix(len(dst.IP))
+	}
+	if src != nil && len(src.IP) != len(dst.IP) {
+		return nil, nil, fmt.Errorf("source %v and destination %v are of different families", src, dst)
+	}
+	return src, dst, nil
+}
+
+// defaultFamily returns the address length "default" stands for when neither
+// prefix pins the family.
+func (r *Route) defaultFamily() int {
+	if r.iface == nil || len(r.iface.addrs) == 0 {
+		return net.IPv4len
+	}
+	for _, a := range r.iface.addrs {
+		if a.IP.To4() != nil {
+			return net.IPv4len
+		}
+	}
+	return net.IPv6len
+}
+
+// anyPrefix returns the /0 prefix for addresses of length ipLen.
+func anyPrefix(ipLen int) *net.IPNet {
+	return &net.IPNet{IP: make(net.IP, ipLen), Mask: net.CIDRMask(0, 8*ipLen)}
+}
+
+// parsePrefix parses a CIDR prefix, accepting a bare address as a host route
+// (/32 for IPv4, /128 for IPv6). The result is normalized.
+func parsePrefix(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, &net.ParseError{Type: "IP address", Text: s}
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(8*len(ip), 8*len(ip))}, nil
+	}
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeNet(n), nil
+}
+
+// normalizeNet rewrites IPv4 prefixes, including the IPv4-mapped
+// ::ffff:a.b.c.d/96+ form, to a 4-byte IP and mask so that the family of a
+// prefix can be told from the length of its IP alone; an IPv6 /128 host route
+// thus always stays IPv6. It returns nil for a prefix whose mask is not
+// contiguous or is too short for an IPv6 address, which would otherwise be
+// filed under the wrong prefix.
+func normalizeNet(n *net.IPNet) *net.IPNet {
+	if n == nil {
+		return nil
+	}
+	ones, bits := n.Mask.Size()
+	ip4 := n.IP.To4()
+	switch {
+	case bits == 0 || n.IP.To16() == nil:
+		return nil
+	case ip4 != nil && bits == 8*net.IPv4len:
+		return &net.IPNet{IP: ip4, Mask: n.Mask}
+	case ip4 != nil && bits == 8*net.IPv6len && ones >= 96:
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(ones-96, 8*net.IPv4len)}
+	case bits != 8*net.IPv6len:
+		return nil
+	}
+	return &net.IPNet{IP: n.IP.To16(), Mask: n.Mask}
 }
 
 // NextHopIP Added for NextHop
@@ -50,26 +313,16 @@ func (r *Route) NextHopIP() net.IP {
 	return net.ParseIP(r.NextHop)
 }
 
+// FirstAddressSelector returns the first preferred address, falling back to
+// the first deprecated and then the first tentative one.
 func FirstAddressSelector(a []*InterfaceAddress, src, dst net.IP) *InterfaceAddress {
-	if len(a) > 0 {
-		return a[0]
-	}
-	return nil
+	return bestRanked(a, func(*InterfaceAddress) bool { return true })
 }
 
 // FitAddressSelector Added for NextHop
 // Select Correct Address to Reach NextHop
 func FitAddressSelector(a []*InterfaceAddress, src, dst net.IP) *InterfaceAddress {
-	for _, A := range a {
-		var ipNet = net.IPNet{
-			IP:   A.IP,
-			Mask: A.Netmask,
-		}
-		if ipNet.Contains(dst) {
-			return A
-		}
-	}
-	return nil
+	return bestRanked(a, func(A *InterfaceAddress) bool { return A.Contains(dst) })
 }
 
 type InterfaceAddress struct {
@@ -77,109 +330,924 @@ type InterfaceAddress struct {
 	Netmask   net.IPMask
 	Broadaddr net.IP
 	Gateway   net.IP
+	Zone      string // IPv6 zone of a link-local IP, e.g. "eth0"
+	// Deprecated marks an address past its preferred lifetime and Tentative
+	// one still undergoing duplicate address detection. Selectors use such
+	// addresses only when the interface has no preferred one, see Preferred.
+	Deprecated bool
+	Tentative  bool
 }
 
+// Network returns the subnet the address is on, e.g. 192.168.1.0/24 for
+// 192.168.1.7 with mask 255.255.255.0, or nil if the Netmask does not fit the
+// IP. The IPv4 forms of either are accepted in 4- or 16-byte length.
+func (a *InterfaceAddress) Network() *net.IPNet {
+	ip := a.IP.Mask(a.Netmask)
+	if ip == nil {
+		return nil
+	}
+	return &net.IPNet{IP: ip, Mask: a.Netmask[len(a.Netmask)-len(ip):]}
+}
+
+// Contains reports whether ip is on the address's subnet.
+func (a *InterfaceAddress) Contains(ip net.IP) bool {
+	n := a.Network()
+	return n != nil && n.Contains(ip)
+}
+
+// Router is a routing table. It is safe for concurrent use: lookups take a
+// shared lock and may run in parallel with each other, while AddRoutes,
+// RemoveRoute and Update take an exclusive lock. The map returned by
+// Interfaces is the router's own storage and must not be read while another
+// goroutine mutates the router.
+//
+// IPv4-mapped IPv6 addresses (::ffff:a.b.c.d) are always taken as the IPv4
+// address they map, in lookups and in route prefixes alike: a lookup for
+// ::ffff:1.2.3.4 is matched against the IPv4 routes, and a route to
+// ::ffff:0:0/96 is stored, listed and matched as 0.0.0.0/0. No IPv6 route
+// matches a mapped address.
 type Router struct {
+	mu     sync.RWMutex
 	ifaces map[int64]*Interface
-	v4, v6 routeSlice
+	byName map[string]*Interface // index of ifaces, see setInterface
+	tables map[int]*table
+	main   *table // tables[MainTable]
+	rules  []Rule // by Priority
+
+	// Set by options.
+	special         bool                     // see WithSpecialAddresses
+	defaultSelector InterfaceAddressSelector // see WithDefaultSelector
+	metrics         Metrics
+	cache           *lookupCache
+	less            func(a, b *RTInfo) bool // see WithComparator
+	logger          Logger
+	hash            FlowHashFunc // see WithFlowHash
+	lastResort      int64        // see SetDefaultInterface, if hasLastResort
+	hasLastResort   bool
+	connected       bool // see WithConnectedRoutes
+
+	subs []chan Event // see Subscribe
+}
+
+// Option configures a Router at construction.
+type Option func(*Router)
+
+// WithComparator replaces routeLess, the order in which lookups consider the
+// routes matching a destination, with less; e.g. lowest priority first and
+// longest prefix only after that. Routes that less orders neither way form an
+// ECMP group and keep their default order among themselves. Default routes
+// still come after every other route, see RTInfo.IsDefault. Matches are
+// sorted on every lookup, so a comparator costs an allocation per lookup, and
+// listings such as V4Route keep the default order.
+func WithComparator(less func(a, b *RTInfo) bool) Option {
+	return func(r *Router) {
+		if less == nil {
+			r.less = nil
+			return
+		}
+		r.less = func(a, b *RTInfo) bool {
+			if a.IsDefault() != b.IsDefault() {
+				return b.IsDefault()
+			}
+			return less(a, b)
+		}
+	}
 }
 
-func NewRouter() *Router {
-	return &Router{
+func NewRouter(opts ...Option) *Router {
+	r := &Router{
 		ifaces: make(map[int64]*Interface),
+		byName: make(map[string]*Interface),
+	}
+	r.clearTables()
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// clearTables replaces all tables with an empty main table.
+func (r *Router) clearTables() {
+	r.main = &table{id: MainTable}
+	r.tables = map[int]*table{MainTable: r.main}
+}
+
+// ClearRoutes drops every route, in all tables, keeping the interfaces and
+// rules so that a full reload keeps interface identity. Under
+// WithConnectedRoutes the connected routes of the interfaces are installed
+// again.
+func (r *Router) ClearRoutes() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.emitRemovedAll()
+	r.clearTables()
+	r.routesChanged()
+	for _, id := range sortedIfaceIDs(r.ifaces) {
+		r.addConnected(r.ifaces[id])
+	}
+	if r.logger != nil {
+		r.logger.Infof("cleared all routes")
+	}
+}
+
+// FlushAll is ClearRoutes that also drops the interfaces and rules.
+func (r *Router) FlushAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.emitRemovedAll()
+	r.clearTables()
+	clear(r.ifaces)
+	clear(r.byName)
+	r.rules = nil
+	r.routesChanged()
+	if r.logger != nil {
+		r.logger.Infof("flushed all routes, interfaces and rules")
 	}
 }
 
+// Reset returns the router to the state NewRouter left it in, keeping the
+// options it was built with, so that it can be refilled, e.g. from a
+// sync.Pool. Routes, tables, interfaces, rules and cached lookups are dropped
+// and subscriber channels are closed.
+func (r *Router) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, sub := range r.subs {
+		close(sub)
+	}
+	r.subs = nil
+	for _, f := range []*routeFamily{&r.main.v4, &r.main.v6} {
+		clear(f.routes)
+		*f = routeFamily{routes: f.routes[:0]}
+	}
+	clear(r.tables)
+	r.tables[MainTable] = r.main
+	clear(r.ifaces)
+	clear(r.byName)
+	r.rules = r.rules[:0]
+	r.routesChanged()
+	if r.logger != nil {
+		r.logger.Infof("reset")
+	}
+}
+
+// routesChanged must be called, with the write lock held, after any change to
+// the route tables.
+func (r *Router) routesChanged() {
+	if r.cache != nil {
+		r.cache.purge()
+	}
+}
+
+// V4Route returns the main table's IPv4 routes in lookup order. The slice is
+// a copy the caller may modify; the routes themselves are the router's own,
+// and changing one in place takes an Update, see there.
 func (r *Router) V4Route() []*RTInfo {
-	return r.v4
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.main.v4.routes)
 }
+
+// V6Route is V4Route for the IPv6 routes.
 func (r *Router) V6Route() []*RTInfo {
-	return r.v6
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.main.v6.routes)
+}
+
+// Routes iterates over the main table's routes, IPv4 before IPv6, each
+// family in lookup order, without copying them. The read lock is held for the
+// whole iteration, so the loop body must not call methods of the router:
+// mutations deadlock, and so can lookups once a writer is waiting.
+func (r *Router) Routes() iter.Seq[*RTInfo] {
+	return func(yield func(*RTInfo) bool) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		for _, f := range []*routeFamily{&r.main.v4, &r.main.v6} {
+			for _, rt := range f.routes {
+				if !yield(rt) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Walk calls fn for each of the main table's routes, IPv4 before IPv6, each
+// family in lookup order, with family 4 or 6, until fn returns true. Like
+// Routes it holds the read lock throughout, so fn must not call methods of
+// the router.
+func (r *Router) Walk(fn func(family int, rt *RTInfo) (stop bool)) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, f := range []struct {
+		family int
+		routes routeSlice
+	}{{4, r.main.v4.routes}, {6, r.main.v6.routes}} {
+		for _, rt := range f.routes {
+			if fn(f.family, rt) {
+				return
+			}
+		}
+	}
+}
+
+// Len returns the number of routes in the main table, LenV4() + LenV6().
+func (r *Router) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.main.v4.routes) + len(r.main.v6.routes)
+}
+
+// LenV4 returns the number of IPv4 routes in the main table.
+func (r *Router) LenV4() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.main.v4.routes)
+}
+
+// LenV6 returns the number of IPv6 routes in the main table.
+func (r *Router) LenV6() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.main.v6.routes)
 }
 
 func (r *Router) Interfaces() map[int64]*Interface {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	return r.ifaces
 }
 
-func (r *Router) AddRoutes(priority uint32, routes ...*Route) {
-	for _, route := range routes {
-		iface, err := route.Interface()
-		if err != nil {
-			continue
+// SetInterfaceState brings the interface with the given id up or down. While
+// it is down lookups skip the routes via it and fall through to the next best
+// match, so routes need not be removed to model a failover.
+func (r *Router) SetInterfaceState(id int64, up bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	iface := r.ifaces[id]
+	if iface == nil {
+		return fmt.Errorf("unknown interface %d", id)
+	}
+	if iface.down != !up {
+		iface.down = !up
+		r.routesChanged()
+		typ := InterfaceUp
+		if !up {
+			typ = InterfaceDown
+		}
+		r.emit(Event{Type: typ, Interface: iface})
+	}
+	return nil
+}
+
+// AddRoute installs a single route with priority added to its own Priority
+// and returns the entry created for it.
+func (r *Router) AddRoute(priority uint32, route *Route) (*RTInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rt, err := r.addRoute(r.main, priority, route)
+	if err != nil {
+		return nil, fmt.Errorf("route (dst %q): %w", route.Dst, err)
+	}
+	return rt, nil
+}
+
+// AddRoutes installs routes with priority added to each route's own Priority.
+// Invalid routes are skipped and reported in the returned error, one entry per
+// route; the valid ones are installed regardless, so callers that do not care
+// can ignore the error.
+func (r *Router) AddRoutes(priority uint32, routes ...*Route) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	for i, route := range routes {
+		if _, err := r.addRoute(r.main, priority, route); err != nil {
+			errs = append(errs, fmt.Errorf("route %d (dst %q): %w", i, route.Dst, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SwapRoutes replaces the main table's routes with v4 and v6 in one step,
+// so that a lookup sees either the old routes or the new ones, never a mix.
+// The router installs copies of the RTInfos, leaving the caller's alone; they
+// are sorted into lookup order and a zero Weight is taken as 1. Nothing is
+// replaced if any route has no Dst, is in the wrong family or, being unicast,
+// references an unknown interface. Under WithConnectedRoutes the router keeps
+// its connected routes and skips those among v4 and v6.
+func (r *Router) SwapRoutes(v4, v6 []*RTInfo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	var next table
+	families := []struct {
+		name   string
+		routes []*RTInfo
+		f, cur *routeFamily
+		ipLen  int
+	}{{"v4", v4, &next.v4, &r.main.v4, net.IPv4len}, {"v6", v6, &next.v6, &r.main.v6, net.IPv6len}}
+	for _, in := range families {
+		for i, rt := range in.routes {
+			dst := normalizeNet(rt.Dst)
+			switch {
+			case dst == nil || len(dst.IP) != in.ipLen:
+				errs = append(errs, fmt.Errorf("%s route %d (dst %v): missing or wrong family destination", in.name, i, rt.Dst))
+			case rt.Type == RouteUnicast && r.ifaces[rt.Iface] == nil:
+				errs = append(errs, fmt.Errorf("%s route %d (dst %v): unknown interface %d", in.name, i, rt.Dst, rt.Iface))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	for _, in := range families {
+		for _, rt := range in.cur.routes {
+			if r.connected && rt.Connected {
+				in.f.routes = append(in.f.routes, rt)
+			}
+		}
+		for _, rt := range in.routes {
+			if r.connected && rt.Connected {
+				continue
+			}
+			c := rt.clone()
+			c.Dst = normalizeNet(rt.Dst)
+			c.Weight = max(rt.Weight, 1)
+			in.f.routes = append(in.f.routes, c)
+		}
+		in.f.rebuild()
+	}
+
+	old := *r.main
+	r.main.v4, r.main.v6 = next.v4, next.v6
+	r.routesChanged()
+	for _, f := range []*routeFamily{&old.v4, &old.v6} {
+		for _, rt := range f.routes {
+			if !(r.connected && rt.Connected) {
+				r.emit(Event{Type: RouteRemoved, Table: MainTable, Route: rt})
+			}
+		}
+	}
+	for _, f := range []*routeFamily{&r.main.v4, &r.main.v6} {
+		for _, rt := range f.routes {
+			if !(r.connected && rt.Connected) {
+				r.emit(Event{Type: RouteAdded, Table: MainTable, Route: rt})
+			}
+		}
+	}
+	if r.logger != nil {
+		r.logger.Infof("table %d: swapped in %d routes", MainTable, len(v4)+len(v6))
+	}
+	return nil
+}
+
+// AddCIDRs is AddRoutes for routes via iface to each of dsts, given as for
+// Route.Dst, from any source. Destinations that fail to parse are skipped
+// and listed in the returned error.
+func (r *Router) AddCIDRs(iface *Interface, priority uint32, dsts ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	for _, dst := range dsts {
+		if _, err := r.addRoute(r.main, priority, &Route{iface: iface, Dst: dst}); err != nil {
+			errs = append(errs, fmt.Errorf("dst %q: %w", dst, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Router) addRoute(t *table, priority uint32, route *Route) (*RTInfo, error) {
+	iface, src, dst, err := route.prepare()
+	if err != nil {
+		return nil, err
+	}
+	selector := route.Selector()
+	if route.AddressSelector == nil && route.SelectorName == "" && r.defaultSelector != nil {
+		selector = r.defaultSelector
+	}
+	rt := &RTInfo{
+		Src:           src,
+		Dst:           dst,
+		Selector:      selector,
+		SelectorName:  route.SelectorName,
+		Priority:      route.Priority + priority,
+		AdminDistance: route.AdminDistance,
+		Iface:         NoInterface,
+		NextHop:       route.NextHopIP(), // Added for NextHop
+		Type:          route.Type,
+		Expiry:        route.Expiry,
+		Weight:        max(route.Weight, 1),
+		Onlink:        route.Onlink,
+		Scope:         route.Scope,
+		Proto:         route.Proto,
+		DstPorts:      route.DstPorts,
+		Mark:          route.Mark,
+		Labels:        maps.Clone(route.Labels),
+	}
+	if iface != nil {
+		registered := r.ifaces[iface.Id] == iface
+		r.setInterface(iface)
+		if !registered {
+			r.addConnected(iface)
+		}
+		rt.Iface = iface.Id
+	}
+	t.familyOfNet(dst).add(rt)
+	r.routesChanged()
+	r.emit(Event{Type: RouteAdded, Table: t.id, Route: rt})
+	if r.logger != nil {
+		r.logger.Infof("table %d: added route %v", t.id, rt)
+	}
+	return rt, nil
+}
+
+// ReplaceRoute is AddRoute that first drops any main table route with the same
+// Dst prefix and interface, so re-applying a configuration leaves the table
+// size unchanged. The new entry inherits the hit count of the first entry it
+// replaces.
+func (r *Router) ReplaceRoute(priority uint32, route *Route) (*RTInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rt, err := r.replaceRoute(r.main, priority, route)
+	if err != nil {
+		return nil, fmt.Errorf("route (dst %q): %w", route.Dst, err)
+	}
+	return rt, nil
+}
+
+// ReplaceRoutes is AddRoutes with the replace semantics of ReplaceRoute.
+func (r *Router) ReplaceRoutes(priority uint32, routes ...*Route) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var errs []error
+	for i, route := range routes {
+		if _, err := r.replaceRoute(r.main, priority, route); err != nil {
+			errs = append(errs, fmt.Errorf("route %d (dst %q): %w", i, route.Dst, err))
 		}
-		r.ifaces[iface.Id] = iface
-		rt := &RTInfo{
-			Src:      route.SrcNet(),
-			Dst:      route.DstNet(),
-			Selector: route.Selector(),
-			Priority: route.Priority + priority,
-			Iface:    iface.Id,
-			NextHop:  route.NextHopIP(), // Added for NextHop
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Router) replaceRoute(t *table, priority uint32, route *Route) (*RTInfo, error) {
+	rt, err := r.addRoute(t, priority, route)
+	if err != nil {
+		return nil, err
+	}
+	var old *RTInfo
+	r.removeRoutes(t, t.familyOfNet(rt.Dst), func(c *RTInfo) bool {
+		if c == rt || c.Iface != rt.Iface || !samePrefix(c.Dst, rt.Dst) {
+			return false
 		}
-		if len(route.DstNet().IP) == net.IPv4len {
-			r.v4 = append(r.v4, rt)
-		} else if len(route.DstNet().IP) == net.IPv6len {
-			r.v6 = append(r.v6, rt)
+		if old == nil {
+			old = c
+		}
+		return true
+	})
+	if old != nil {
+		atomic.StoreUint64(&rt.hits, old.Hits())
+	}
+	return rt, nil
+}
+
+// RemoveRoute deletes every route whose destination is exactly dst (same
+// address and prefix length) and returns how many were removed. Routes that
+// merely contain or are contained by dst are left alone.
+func (r *Router) RemoveRoute(dst *net.IPNet) int {
+	dst = normalizeNet(dst)
+	if dst == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := r.removeRoutes(r.main, r.main.familyOfNet(dst), func(rt *RTInfo) bool { return samePrefix(rt.Dst, dst) })
+	if n > 0 {
+		r.routesChanged()
+		if r.logger != nil {
+			r.logger.Infof("table %d: removed %d routes to %v", MainTable, n, dst)
+		}
+	}
+	return n
+}
+
+// RemoveInterface deletes the interface with the given id along with every
+// route via it, in all tables, and returns how many routes were removed.
+func (r *Router) RemoveInterface(id int64) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ifaces[id] == nil {
+		return 0
+	}
+	r.deleteInterface(id)
+	n := 0
+	for _, t := range r.tables {
+		for _, f := range []*routeFamily{&t.v4, &t.v6} {
+			n += r.removeRoutes(t, f, func(rt *RTInfo) bool { return rt.Iface == id })
 		}
 	}
+	r.routesChanged()
+	if r.logger != nil {
+		r.logger.Infof("removed interface %d and %d routes via it", id, n)
+	}
+	return n
+}
+
+func samePrefix(a, b *net.IPNet) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	aOnes, aBits := a.Mask.Size()
+	bOnes, bBits := b.Mask.Size()
+	return aOnes == bOnes && aBits == bBits && a.IP.Equal(b.IP)
 }
+
+// Update re-sorts the tables after routes were changed in place, e.g. the
+// Priority of an RTInfo returned by V4Route. Such changes must not race with
+// lookups or other mutations. Adding and removing routes keeps the tables in
+// order by itself, so Update is then a cheap no-op.
 func (r *Router) Update() {
-	sort.Sort(r.v4)
-	sort.Sort(r.v6)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	changed := false
+	for _, t := range r.tables {
+		for _, f := range []*routeFamily{&t.v4, &t.v6} {
+			if !sort.IsSorted(f.routes) {
+				f.rebuild()
+				changed = true
+			}
+		}
+	}
+	if changed {
+		r.routesChanged()
+	}
+	if r.logger != nil {
+		r.logger.Debugf("update: re-sorted %v", changed)
+	}
 }
 
 func (r *Router) String() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	strs := []string{"ROUTER", "--- V4 ---"}
-	for _, route := range r.v4 {
-		strs = append(strs, fmt.Sprintf("%+v", *route))
+	for _, route := range r.main.v4.routes {
+		strs = append(strs, route.String())
 	}
 	strs = append(strs, "--- V6 ---")
-	for _, route := range r.v6 {
-		strs = append(strs, fmt.Sprintf("%+v", *route))
+	for _, route := range r.main.v6.routes {
+		strs = append(strs, route.String())
 	}
 	return strings.Join(strs, "\n")
 }
 
-func (r *Router) RouteWithSrc(src, dst net.IP) (iface *Interface, preferredSrc *InterfaceAddress, err error) {
-	var rt *RTInfo
-	switch {
-	case dst.To4() != nil:
-		rt, err = r.route(r.v4, src, dst)
-	case dst.To16() != nil:
-		rt, err = r.route(r.v6, src, dst)
-	default:
-		err = errors.New("IP is not valid as IPv4 or IPv6")
+// Lookup returns the route that wins for the src/dst pair, without resolving
+// its interface or source address. A blackhole or unreachable winner is
+// returned without error; check its Type.
+func (r *Router) Lookup(src, dst net.IP) (*RTInfo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.route(r.main, src, dst)
+}
+
+// LookupAll returns every route whose Src and Dst contain the pair, in the
+// order lookups evaluate them, see routeLess.
+func (r *Router) LookupAll(src, dst net.IP) []*RTInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var all []*RTInfo
+	r.candidates(r.main, query{src: src, dst: dst}, func(rt *RTInfo) bool {
+		all = append(all, rt)
+		return true
+	})
+	return all
+}
+
+// RoutesForInterface returns the main table's routes via the interface with
+// the given id, IPv4 before IPv6, each family in lookup order.
+func (r *Router) RoutesForInterface(id int64) []*RTInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var routes []*RTInfo
+	for _, f := range []*routeFamily{&r.main.v4, &r.main.v6} {
+		var fr routeSlice
+		for _, rt := range f.routes {
+			if rt.Iface == id {
+				fr = append(fr, rt)
+			}
+		}
+		sort.Stable(fr)
+		routes = append(routes, fr...)
+	}
+	return routes
+}
+
+// RoutesViaGateway returns the main table's unicast routes that forward to
+// gw, IPv4 before IPv6, each family in lookup order: those with gw as
+// NextHop and those without a NextHop whose selected address, picked as in
+// FormatTable from all the interface's addresses, has gw as its Gateway.
+func (r *Router) RoutesViaGateway(gw net.IP) []*RTInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []*RTInfo
+	for _, f := range []*routeFamily{&r.main.v4, &r.main.v6} {
+		for _, rt := range f.routes {
+			if r.viaGateway(rt, gw) {
+				out = append(out, rt)
+			}
+		}
+	}
+	return out
+}
+
+// RoutesMatchingLabels returns the main table's routes whose Labels include
+// every key and value of selector, IPv4 before IPv6, each family in lookup
+// order; e.g. {"origin": "bgp"} finds the routes learned over BGP. An empty
+// selector matches every route.
+func (r *Router) RoutesMatchingLabels(selector map[string]string) []*RTInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []*RTInfo
+	for _, f := range []*routeFamily{&r.main.v4, &r.main.v6} {
+		for _, rt := range f.routes {
+			if hasLabels(rt, selector) {
+				out = append(out, rt)
+			}
+		}
+	}
+	return out
+}
+
+func hasLabels(rt *RTInfo, selector map[string]string) bool {
+	for k, v := range selector {
+		if got, ok := rt.Labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// DeleteRoutesViaGateway removes the main table routes RoutesViaGateway would
+// return for gw, e.g. to withdraw them once gw is found unreachable, and
+// returns how many were removed.
+func (r *Router) DeleteRoutesViaGateway(gw net.IP) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, f := range []*routeFamily{&r.main.v4, &r.main.v6} {
+		n += r.removeRoutes(r.main, f, func(rt *RTInfo) bool { return r.viaGateway(rt, gw) })
+	}
+	if n > 0 {
+		r.routesChanged()
+		if r.logger != nil {
+			r.logger.Infof("table %d: removed %d routes via %v", MainTable, n, gw)
+		}
+	}
+	return n
+}
+
+// viaGateway reports whether rt is a unicast route forwarding to gw, see
+// RoutesViaGateway.
+func (r *Router) viaGateway(rt *RTInfo, gw net.IP) bool {
+	iface := r.ifaces[rt.Iface]
+	if rt.Type != RouteUnicast || iface == nil {
+		return false
+	}
+	nh := r.tableNextHop(rt, iface)
+	return !nh.OnLink && nh.Gateway.Equal(gw)
+}
+
+// CountRoutesForInterface returns len(RoutesForInterface(id)) without
+// building the list.
+func (r *Router) CountRoutesForInterface(id int64) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	n := 0
+	for _, f := range []*routeFamily{&r.main.v4, &r.main.v6} {
+		for _, rt := range f.routes {
+			if rt.Iface == id {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// DefaultRouteV4 returns the 0.0.0.0/0 route that applies to any source and
+// flow with the lowest AdminDistance, then the lowest Priority, if any, as a
+// lookup would rank it. Routes restricted by a source prefix or flow
+// criteria, which lookups try first, are only returned when there is no
+// other default route.
+func (r *Router) DefaultRouteV4() (*RTInfo, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.main.v4.defaultRoute()
+}
+
+// DefaultRouteV6 is DefaultRouteV4 for ::/0.
+func (r *Router) DefaultRouteV6() (*RTInfo, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.main.v6.defaultRoute()
+}
+
+// GetRoute returns the main table route whose destination is exactly dst
+// (same address and prefix length), choosing among several like
+// DefaultRouteV4. Unlike Lookup, routes that merely contain dst do not count.
+func (r *Router) GetRoute(dst *net.IPNet) (*RTInfo, bool) {
+	dst = normalizeNet(dst)
+	if dst == nil {
+		return nil, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.main.familyOfNet(dst).exact(dst)
+}
+
+// HasRoute reports whether GetRoute would find a route to dst.
+func (r *Router) HasRoute(dst *net.IPNet) bool {
+	_, ok := r.GetRoute(dst)
+	return ok
+}
+
+// RouteWithSrc returns the egress interface, the preferred source address and
+// the next hop for dst. The route's own NextHop wins; otherwise dst is on-link
+// when it lies in the selected address's subnet, else the address's Gateway
+// is used.
+//
+// A route's NextHop that is not on a subnet of the route's interface is
+// resolved recursively, like a BGP next hop: the gateway is looked up in turn
+// and its egress interface, source address and on-link next hop are returned.
+// Resolution gives up after MaxResolveDepth levels.
+//
+// An IPv4-mapped dst is resolved as the IPv4 address it maps, see Router.
+func (r *Router) RouteWithSrc(src, dst net.IP) (iface *Interface, preferredSrc *InterfaceAddress, nextHop NextHop, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res, err := r.resolve(context.Background(), r.main, query{src: src, dst: dst}, 0)
+	if err != nil {
+		return
+	}
+	return res.iface, res.addr, res.nextHop, nil
+}
+
+// RouteWithSrcContext is RouteWithSrc that stops resolving a recursive next
+// hop once ctx is done, failing with an error wrapping ctx.Err().
+func (r *Router) RouteWithSrcContext(ctx context.Context, src, dst net.IP) (iface *Interface, preferredSrc *InterfaceAddress, nextHop NextHop, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res, err := r.resolve(ctx, r.main, query{src: src, dst: dst}, 0)
+	if err != nil {
+		return
+	}
+	return res.iface, res.addr, res.nextHop, nil
+}
+
+// RouteWithMTU is RouteWithSrc that also returns the path MTU: the
+// EffectiveMTU of the egress interface or, for a recursively resolved next
+// hop, the smallest one among the interfaces of the routes on the way.
+func (r *Router) RouteWithMTU(src, dst net.IP) (iface *Interface, preferredSrc *InterfaceAddress, nextHop NextHop, mtu int, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res, err := r.resolve(context.Background(), r.main, query{src: src, dst: dst}, 0)
+	if err != nil {
+		return
 	}
+	return res.iface, res.addr, res.nextHop, res.mtu, nil
+}
+
+// MaxResolveDepth bounds recursive next-hop resolution in RouteWithSrc.
+const MaxResolveDepth = 8
 
+// resolution is the outcome of resolving a destination to an egress.
+type resolution struct {
+	rt      *RTInfo // route matched for the destination itself
+	iface   *Interface
+	addr    *InterfaceAddress
+	nextHop NextHop
+	mtu     int // smallest EffectiveMTU along the path
+}
+
+// resolve resolves q in t, giving up with ctx.Err() once ctx is done.
+func (r *Router) resolve(ctx context.Context, t *table, q query, depth int) (res resolution, err error) {
+	if err := ctx.Err(); err != nil {
+		return resolution{}, err
+	}
+	if depth == 0 && r.special {
+		if res, ok, err := r.resolveSpecial(t, q); ok {
+			return res, err
+		}
+	}
+	rt, err := r.routeTables([]*table{t}, q)
+	if errors.Is(err, ErrNoRoute) && depth == 0 {
+		if res, ok := r.resolveLastResort(q); ok {
+			return res, nil
+		}
+	}
+	if err == nil {
+		err = rt.typeError(q.dst)
+	}
 	if err != nil {
 		return
 	}
-	iface = r.ifaces[rt.Iface]
+	return r.resolveRoute(ctx, t, rt, q, depth)
+}
+
+// resolveRoute is resolve once rt has been matched for q.
+func (r *Router) resolveRoute(ctx context.Context, t *table, rt *RTInfo, q query, depth int) (res resolution, err error) {
+	iface, err := r.routeInterface(rt)
+	if err != nil {
+		return
+	}
+
+	addr := r.selectorOf(rt)(iface.Addresses(), q.src, q.dst)
+	res = resolution{rt: rt, iface: iface, addr: addr, nextHop: chooseNextHop(rt, addr, q.dst), mtu: iface.EffectiveMTU()}
+	if rt.NextHop == nil || rt.Onlink || onLink(iface, rt.NextHop) {
+		return res, nil
+	}
+	if depth == MaxResolveDepth {
+		return resolution{}, fmt.Errorf("next hop %v unresolved after %d levels", rt.NextHop, depth)
+	}
+	via, err := r.resolve(ctx, t, query{src: q.src, dst: rt.NextHop}, depth+1)
+	if err != nil {
+		if depth == 0 {
+			err = fmt.Errorf("resolving next hop %v: %w", rt.NextHop, err)
+		}
+		return resolution{}, err
+	}
+	res.iface, res.addr, res.mtu = via.iface, via.addr, min(res.mtu, via.mtu)
+	if !via.nextHop.OnLink {
+		res.nextHop = via.nextHop
+	}
+	return res, nil
+}
+
+// selectorOf returns the address selector rt uses: its own, else the
+// router's default.
+func (r *Router) selectorOf(rt *RTInfo) InterfaceAddressSelector {
+	switch {
+	case rt.Selector != nil:
+		return rt.Selector
+	case r.defaultSelector != nil:
+		return r.defaultSelector
+	}
+	return FirstAddressSelector
+}
 
-	var selector InterfaceAddressSelector = FirstAddressSelector
-	if rt.Selector != nil {
-		selector = rt.Selector
+// routeInterface returns the interface rt egresses through, or an error
+// rather than nil if the route outlived it.
+func (r *Router) routeInterface(rt *RTInfo) (*Interface, error) {
+	iface := r.ifaces[rt.Iface]
+	if iface == nil {
+		return nil, fmt.Errorf("route references unknown interface %d", rt.Iface)
 	}
-	return iface, selector(iface.Addresses(), src, dst), nil
+	return iface, nil
+}
+
+// onLink reports whether ip is on a subnet of iface. An interface without
+// addresses gives nothing to check against and is taken to reach any ip.
+func onLink(iface *Interface, ip net.IP) bool {
+	if len(iface.addrs) == 0 {
+		return true
+	}
+	for _, a := range iface.addrs {
+		if a.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func chooseNextHop(rt *RTInfo, addr *InterfaceAddress, dst net.IP) NextHop {
+	switch {
+	case rt.NextHop != nil:
+		return NextHop{Gateway: rt.NextHop}
+	case rt.Onlink, addr != nil && addr.Contains(dst):
+		return NextHop{OnLink: true}
+	case addr != nil && addr.Gateway != nil:
+		return NextHop{Gateway: addr.Gateway}
+	}
+	return NextHop{OnLink: true}
 }
 
 // RouteWithNextHop Added for NextHop
 // Add nextHop as return
 func (r *Router) RouteWithNextHop(src, dst net.IP) (iface *Interface, preferredSrc *InterfaceAddress, nextHop net.IP, err error) {
-	var rt *RTInfo
-	switch {
-	case dst.To4() != nil:
-		rt, err = r.route(r.v4, src, dst)
-	case dst.To16() != nil:
-		rt, err = r.route(r.v6, src, dst)
-	default:
-		err = errors.New("IP is not valid as IPv4 or IPv6")
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rt, err := r.route(r.main, src, dst)
+	if errors.Is(err, ErrNoRoute) {
+		if res, ok := r.resolveLastResort(query{src: src, dst: dst}); ok {
+			return res.iface, res.addr, res.nextHop.Gateway, nil
+		}
+	}
+	if err == nil {
+		err = rt.typeError(dst)
 	}
-
 	if err != nil {
 		return
 	}
-	iface = r.ifaces[rt.Iface]
+	if iface, err = r.routeInterface(rt); err != nil {
+		return
+	}
 
 	var selector InterfaceAddressSelector = FitAddressSelector // Use This to cope with NextHop
 	//if rt.Selector != nil {
@@ -192,26 +1260,198 @@ func (r *Router) RouteWithNextHop(src, dst net.IP) (iface *Interface, preferredS
 	return iface, selector(iface.Addresses(), src, target), rt.NextHop, nil
 }
 
-func (r *Router) route(routes routeSlice, src, dst net.IP) (rt *RTInfo, err error) {
-	for _, rt = range routes {
-		if rt.Src != nil && !rt.Src.Contains(src) {
-			continue
+// query is what a lookup matches routes against.
+type query struct {
+	src, dst net.IP
+	zone     string // zone of a link-local dst, see Interface.InZone
+	scope    Scope  // widest scope admitted if scoped, see LookupScope
+	scoped   bool
+	adjust   map[int64]int // priority adjustments, see LookupAdjusted
+
+	proto        uint8 // rest of the flow, see LookupFlow
+	sport, dport uint16
+	mark         uint32
+}
+
+func (r *Router) route(t *table, src, dst net.IP) (*RTInfo, error) {
+	return r.routeTables([]*table{t}, query{src: src, dst: dst})
+}
+
+// routeTables returns the best match of the first table in tables that has
+// one, counting it as a single lookup.
+func (r *Router) routeTables(tables []*table, q query) (rt *RTInfo, err error) {
+	var start time.Time
+	if r.metrics != nil {
+		start = time.Now()
+	}
+	for _, t := range tables {
+		if rt, err = r.cachedMatch(t, q); rt != nil || err != nil {
+			break
 		}
-		if rt.Dst != nil && !rt.Dst.Contains(dst) {
-			continue
+	}
+	if rt != nil {
+		atomic.AddUint64(&rt.hits, 1)
+	}
+	if r.metrics != nil && err == nil {
+		r.observeLookup(start, q.dst, rt)
+	}
+	if err == nil && rt == nil {
+		// Clone so dst does not escape; LookupAddr passes stack buffers.
+		err = fmt.Errorf("%w for %v", ErrNoRoute, slices.Clone(q.dst))
+		if r.logger != nil {
+			r.logger.Debugf("lookup: %v", err)
 		}
-		return
 	}
-	err = fmt.Errorf("no route found for %v", dst)
 	return
 }
 
+func (r *Router) cachedMatch(t *table, q query) (rt *RTInfo, err error) {
+	if r.cache == nil || q.zone != "" || q.scoped || q.adjust != nil || q.proto != 0 || q.mark != 0 {
+		return r.bestMatch(t, q)
+	}
+	key := makeCacheKey(t.id, q)
+	if rt, _ = r.cache.get(key); rt == nil || rt.expired() {
+		if rt, err = r.bestMatch(t, q); rt != nil {
+			r.cache.put(key, rt)
+		}
+	}
+	return
+}
+
+// bestMatch returns the route a lookup picks, or nil if there is none. When
+// several routes tie for best they form an ECMP group and one member is
+// picked by hashing the flow, so a flow always takes the same member. Each
+// member gets a share of flows in proportion to its Weight.
+func (r *Router) bestMatch(t *table, q query) (rt *RTInfo, err error) {
+	n, total := 0, uint64(0)
+	err = r.candidates(t, q, func(c *RTInfo) bool {
+		if rt != nil && !r.sameCostFor(q, rt, c) {
+			return false
+		}
+		if rt == nil {
+			rt = c
+		}
+		n++
+		total += uint64(max(c.Weight, 1))
+		return true
+	})
+	if n > 1 {
+		h := r.hashFlow(q) % total
+		r.candidates(t, q, func(c *RTInfo) bool {
+			if w := uint64(max(c.Weight, 1)); h >= w {
+				h -= w
+				return true
+			}
+			rt = c
+			return false
+		})
+	}
+	return
+}
+
+// ECMPGroup returns the routes tied for best for the src/dst pair, in lookup
+// order. A lookup picks one of them per flow; without multipath the group is
+// just the winning route.
+func (r *Router) ECMPGroup(src, dst net.IP) ([]*RTInfo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var group []*RTInfo
+	err := r.candidates(r.main, query{src: src, dst: dst}, func(c *RTInfo) bool {
+		if len(group) > 0 && !r.sameCost(group[0], c) {
+			return false
+		}
+		group = append(group, c)
+		return true
+	})
+	return group, err
+}
+
+// candidates calls fn for every route matching q, best first, until fn
+// returns false. The first route passed to fn is the one route() picks.
+// Expired routes and routes via a down interface are skipped, as are, for a
+// link-local dst with a zone, routes via an interface outside the zone, and,
+// for a scoped query, routes narrower than its scope.
+func (r *Router) candidates(t *table, q query, fn func(*RTInfo) bool) error {
+	f, dst, err := t.familyOf(q.dst)
+	if err != nil {
+		return err
+	}
+	zone := ""
+	if dst.IsLinkLocalUnicast() || dst.IsLinkLocalMulticast() {
+		zone = q.zone
+	}
+	usable := func(rt *RTInfo) bool {
+		if rt.Src != nil && !rt.Src.Contains(q.src) || rt.expired() || q.scoped && rt.Scope > q.scope || !rt.matchesFlow(q) {
+			return false
+		}
+		iface := r.ifaces[rt.Iface]
+		return !(iface != nil && iface.down || zone != "" && (iface == nil || !iface.InZone(zone)))
+	}
+	less := r.lessFor(q)
+	if less == nil {
+		f.trie.match(dst, func(rt *RTInfo) bool {
+			return !usable(rt) || fn(rt)
+		})
+		return nil
+	}
+	var matched []*RTInfo
+	f.trie.match(dst, func(rt *RTInfo) bool {
+		if usable(rt) {
+			matched = append(matched, rt)
+		}
+		return true
+	})
+	sort.SliceStable(matched, func(i, j int) bool { return less(matched[i], matched[j]) })
+	for _, rt := range matched {
+		if !fn(rt) {
+			break
+		}
+	}
+	return nil
+}
+
 type RTInfo struct {
-	Src, Dst *net.IPNet
-	Selector InterfaceAddressSelector
-	Priority uint32
-	Iface    int64
-	NextHop  net.IP // Added for NextHop
+	Src, Dst      *net.IPNet
+	Selector      InterfaceAddressSelector
+	SelectorName  string // set if the selector was given by name
+	Priority      uint32
+	AdminDistance uint32 // see Route.AdminDistance
+	Iface         int64
+	NextHop       net.IP // Added for NextHop
+	Type          RouteType
+	Weight        uint32 // share of flows within an ECMP group, at least 1
+	Onlink        bool   // see Route.Onlink
+	Scope         Scope
+	Proto         uint8             // see Route.Proto
+	DstPorts      PortRange         // see Route.DstPorts
+	Mark          uint32            // see Route.Mark
+	Labels        map[string]string // see Route.Labels; treat as read-only
+	Connected     bool              // installed by WithConnectedRoutes
+	// Expiry, if set, is when the route stops matching. ExpireStale removes
+	// expired routes; ReplaceRoute with a later Expiry refreshes one.
+	Expiry time.Time
+	hits   uint64 // updated atomically, see Stats
+}
+
+func (rt *RTInfo) expired() bool {
+	return !rt.Expiry.IsZero() && !time.Now().Before(rt.Expiry)
+}
+
+// IsDefault reports whether rt is a default route, one with a /0 Dst. Lookups
+// only use a default route when no more specific route matches.
+func (rt *RTInfo) IsDefault() bool {
+	if rt.Dst == nil {
+		return false
+	}
+	ones, _ := rt.Dst.Mask.Size()
+	return ones == 0
+}
+
+// String formats the route like %+v of the struct, leaving out the hit
+// counter so that it can be called while lookups are running.
+func (rt *RTInfo) String() string {
+	return fmt.Sprintf("{Src:%v Dst:%v Selector:%p Priority:%d Iface:%d NextHop:%v Type:%v}",
+		rt.Src, rt.Dst, rt.Selector, rt.Priority, rt.Iface, rt.NextHop, rt.Type)
 }
 
 type routeSlice []*RTInfo
@@ -220,17 +1460,92 @@ func (r routeSlice) Len() int {
 	return len(r)
 }
 func (r routeSlice) Less(i, j int) bool {
-	iSize, _ := r[i].Dst.Mask.Size()
-	jSize, _ := r[j].Dst.Mask.Size()
-	if iSize != jSize {
-		return jSize < iSize // large first
-	}
-	return r[i].Priority < r[j].Priority
+	return routeLess(r[i], r[j])
 }
 func (r routeSlice) Swap(i, j int) {
 	r[i], r[j] = r[j], r[i]
 }
 
+// sameCost reports whether a and b, both matching one destination, are
+// equally good and so belong to the same ECMP group: neither is ordered
+// before the other by the router's comparator, or else they share prefix
+// lengths, flow match criteria count, administrative distance and priority.
+func (r *Router) sameCost(a, b *RTInfo) bool {
+	if r.less != nil {
+		return !r.less(a, b) && !r.less(b, a)
+	}
+	return sameCost(a, b)
+}
+
+func sameCost(a, b *RTInfo) bool {
+	return sameCostPriority(a, b, a.Priority, b.Priority)
+}
+
+// sameCostPriority is sameCost with aPrio and bPrio in place of the routes'
+// priorities.
+func sameCostPriority(a, b *RTInfo, aPrio, bPrio uint32) bool {
+	aSize, _ := a.Dst.Mask.Size()
+	bSize, _ := b.Dst.Mask.Size()
+	return aSize == bSize && srcBits(a) == srcBits(b) && flowBits(a) == flowBits(b) && a.AdminDistance == b.AdminDistance && aPrio == bPrio
+}
+
+// routeLess orders routes for lookup, unless replaced by WithComparator:
+// longest prefix first, then longest source prefix, then most flow match
+// criteria, then lowest administrative distance, then lowest priority, then
+// lowest interface id. Routes equal on all six keep the order they were added
+// in.
+func routeLess(a, b *RTInfo) bool {
+	return routeLessPriority(a, b, a.Priority, b.Priority)
+}
+
+// routeLessPriority is routeLess with aPrio and bPrio in place of the routes'
+// priorities.
+func routeLessPriority(a, b *RTInfo, aPrio, bPrio uint32) bool {
+	aSize, _ := a.Dst.Mask.Size()
+	bSize, _ := b.Dst.Mask.Size()
+	if aSize != bSize {
+		return bSize < aSize // large first
+	}
+	if aSrc, bSrc := srcBits(a), srcBits(b); aSrc != bSrc {
+		return bSrc < aSrc
+	}
+	if aFlow, bFlow := flowBits(a), flowBits(b); aFlow != bFlow {
+		return bFlow < aFlow
+	}
+	if a.AdminDistance != b.AdminDistance {
+		return a.AdminDistance < b.AdminDistance
+	}
+	if aPrio != bPrio {
+		return aPrio < bPrio
+	}
+	return a.Iface < b.Iface
+}
+
+// srcBits is the length of rt's source prefix; a route without one matches
+// any source, like a /0.
+func srcBits(rt *RTInfo) int {
+	if rt.Src == nil {
+		return 0
+	}
+	ones, _ := rt.Src.Mask.Size()
+	return ones
+}
+
+// removeFunc drops the entries matching fn, keeping the remaining entries in
+// their current order, and returns how many were dropped.
+func (r *routeSlice) removeFunc(fn func(*RTInfo) bool) int {
+	old := *r
+	kept := old[:0]
+	for _, rt := range old {
+		if !fn(rt) {
+			kept = append(kept, rt)
+		}
+	}
+	clear(old[len(kept):])
+	*r = kept
+	return len(old) - len(kept)
+}
+
 func main() {
 	//初始化路由器
 	router := NewRouter()
@@ -304,51 +1619,53 @@ func main() {
 			NextHop:  "10.0.0.1", // Added for NextHop
 		},
 	}
-	router.AddRoutes(0, rt...)
+	if err := router.AddRoutes(0, rt...); err != nil {
+		fmt.Println(err)
+	}
 	router.Update()
 	fmt.Println(router.String())
 
 	fmt.Println("-- TESTING --")
 
 	//从192.168.1.2到IP 223.5.5.5
-	iface, addr, _ := router.RouteWithSrc(net.ParseIP("192.168.1.2"), net.ParseIP("223.5.5.5"))
-	fmt.Printf("to 223.5.5.5, \tVIA %#s, \tNext: %#s\n", iface.Name, addr.Gateway.String())
+	iface, _, nh, _ := router.RouteWithSrc(net.ParseIP("192.168.1.2"), net.ParseIP("223.5.5.5"))
+	fmt.Printf("to 223.5.5.5, \tVIA %s, \tNext: %s\n", iface.Name, nh)
 
 	//从192.168.1.2到172.16.1.100
-	iface, addr, _ = router.RouteWithSrc(net.ParseIP("192.168.1.2"), net.ParseIP("172.16.1.100"))
-	fmt.Printf("to 172.16.1.100, \tVIA %#s, \tNext: %#s\n", iface.Name, addr.Gateway.String())
+	iface, _, nh, _ = router.RouteWithSrc(net.ParseIP("192.168.1.2"), net.ParseIP("172.16.1.100"))
+	fmt.Printf("to 172.16.1.100, \tVIA %s, \tNext: %s\n", iface.Name, nh)
 
 	//从192.168.1.2到172.16.1.10
-	iface, addr, _ = router.RouteWithSrc(net.ParseIP("192.168.1.2"), net.ParseIP("172.16.1.10"))
-	fmt.Printf("to 172.16.1.10, \tVIA %#s, \tNext: %#s\n", iface.Name, addr.Gateway.String())
+	iface, _, nh, _ = router.RouteWithSrc(net.ParseIP("192.168.1.2"), net.ParseIP("172.16.1.10"))
+	fmt.Printf("to 172.16.1.10, \tVIA %s, \tNext: %s\n", iface.Name, nh)
 
 	//从192.168.1.2到172.16.2.100
-	iface, addr, _ = router.RouteWithSrc(net.ParseIP("192.168.1.2"), net.ParseIP("172.16.2.100"))
-	fmt.Printf("to 172.16.2.100, \tVIA %#s, \tNext: %#s\n", iface.Name, addr.Gateway.String())
+	iface, _, nh, _ = router.RouteWithSrc(net.ParseIP("192.168.1.2"), net.ParseIP("172.16.2.100"))
+	fmt.Printf("to 172.16.2.100, \tVIA %s, \tNext: %s\n", iface.Name, nh)
 
 	//从192.168.1.3到172.16.2.100
-	iface, addr, _ = router.RouteWithSrc(net.ParseIP("192.168.1.2"), net.ParseIP("172.16.3.100"))
-	fmt.Printf("to 172.16.3.100, \tVIA %#s, \tNext: %#s\n", iface.Name, addr.Gateway.String())
+	iface, _, nh, _ = router.RouteWithSrc(net.ParseIP("192.168.1.2"), net.ParseIP("172.16.3.100"))
+	fmt.Printf("to 172.16.3.100, \tVIA %s, \tNext: %s\n", iface.Name, nh)
 
 	fmt.Println("-- TESTING WITH NEXT_HOP --")
 
 	//从192.168.1.2到IP 223.5.5.5
 	iface, addr, nextHop, _ := router.RouteWithNextHop(net.ParseIP("192.168.1.2"), net.ParseIP("223.5.5.5"))
-	fmt.Printf("to 223.5.5.5,    VIA %#s, \tUsing Addr IP: %16s, \tNextHop: %#s\n", iface.Name, addr.IP.String(), nextHop.String())
+	fmt.Printf("to 223.5.5.5,    VIA %s, \tUsing Addr IP: %16s, \tNextHop: %s\n", iface.Name, addr.IP.String(), nextHop.String())
 
 	//从192.168.1.2到172.16.1.100
 	iface, addr, nextHop, _ = router.RouteWithNextHop(net.ParseIP("192.168.1.2"), net.ParseIP("172.16.1.100"))
-	fmt.Printf("to 172.16.1.100, VIA %#s, \tUsing Addr IP: %16s, \tNextHop: %#s\n", iface.Name, addr.IP.String(), nextHop.String())
+	fmt.Printf("to 172.16.1.100, VIA %s, \tUsing Addr IP: %16s, \tNextHop: %s\n", iface.Name, addr.IP.String(), nextHop.String())
 
 	//从192.168.1.2到172.16.1.10
 	iface, addr, nextHop, _ = router.RouteWithNextHop(net.ParseIP("192.168.1.2"), net.ParseIP("172.16.1.10"))
-	fmt.Printf("to 172.16.1.10,  VIA %#s, \tUsing Addr IP: %16s, \tNextHop: %#s\n", iface.Name, addr.IP.String(), nextHop.String())
+	fmt.Printf("to 172.16.1.10,  VIA %s, \tUsing Addr IP: %16s, \tNextHop: %s\n", iface.Name, addr.IP.String(), nextHop.String())
 
 	//从192.168.1.2到172.16.2.100
 	iface, addr, nextHop, _ = router.RouteWithNextHop(net.ParseIP("192.168.1.2"), net.ParseIP("172.16.2.100"))
-	fmt.Printf("to 172.16.2.100, VIA %#s, \tUsing Addr IP: %16s, \tNextHop: %#s\n", iface.Name, addr.IP.String(), nextHop.String())
+	fmt.Printf("to 172.16.2.100, VIA %s, \tUsing Addr IP: %16s, \tNextHop: %s\n", iface.Name, addr.IP.String(), nextHop.String())
 
 	//从192.168.1.3到172.16.2.100
 	iface, addr, nextHop, _ = router.RouteWithNextHop(net.ParseIP("192.168.1.2"), net.ParseIP("172.16.3.100"))
-	fmt.Printf("to 172.16.3.100, VIA %#s, \tUsing Addr IP: %16s, \tNextHop: %#s\n", iface.Name, addr.IP.String(), nextHop.String())
+	fmt.Printf("to 172.16.3.100, VIA %s, \tUsing Addr IP: %16s, \tNextHop: %s\n", iface.Name, addr.IP.String(), nextHop.String())
 }
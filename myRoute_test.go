@@ -0,0 +1,391 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testIface returns an interface carrying an address per CIDR, e.g.
+// "192.168.1.2/24".
+func testIface(t testing.TB, id int64, name string, cidrs ...string) *Interface {
+	t.Helper()
+	iface := &Interface{Id: id, Name: name}
+	for _, c := range cidrs {
+		ip, n, err := net.ParseCIDR(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		iface.addrs = append(iface.addrs, &InterfaceAddress{IP: ip, Netmask: n.Mask})
+	}
+	return iface
+}
+
+func TestAddRoutesFamilyOfIPv4Forms(t *testing.T) {
+	for _, dst := range []string{"0.0.0.0/0", "::ffff:0.0.0.0/96", "10.1.0.0/16", "::ffff:10.1.0.0/112"} {
+		r := NewRouter()
+		if err := r.AddRoutes(0, &Route{iface: testIface(t, 0, "eth0", "10.1.0.2/16"), Dst: dst}); err != nil {
+			t.Fatalf("%s: %v", dst, err)
+		}
+		if r.LenV4() != 1 || r.LenV6() != 0 {
+			t.Fatalf("%s: %d IPv4 and %d IPv6 routes, want 1 and 0", dst, r.LenV4(), r.LenV6())
+		}
+		if got := r.V4Route()[0].Dst; len(got.IP) != net.IPv4len || len(got.Mask) != net.IPv4len {
+			t.Errorf("%s: stored as %v in %d bytes, want 4", dst, got, len(got.IP))
+		}
+	}
+}
+
+func TestAddRoutesReportsInvalid(t *testing.T) {
+	iface := testIface(t, 0, "eth0", "10.0.0.2/8")
+	tests := []struct {
+		name  string
+		route *Route
+	}{
+		{"bad dst", &Route{iface: iface, Dst: "192.168.1.0/33"}},
+		{"bad src", &Route{iface: iface, Src: "10.0.0.0/", Dst: "192.168.1.0/24"}},
+		{"missing dst", &Route{iface: iface}},
+		{"nil interface", &Route{Dst: "192.168.1.0/24"}},
+		{"v6 src, v4 dst", &Route{iface: iface, Src: "2001:db8::/32", Dst: "10.0.0.0/8"}},
+		{"v4 src, v6 dst", &Route{iface: iface, Src: "10.0.0.0/8", Dst: "2001:db8::/32"}},
+	}
+	for _, tt := range tests {
+		r := NewRouter()
+		err := r.AddRoutes(0, &Route{iface: iface, Dst: "default"}, tt.route)
+		if err == nil || !strings.Contains(err.Error(), "route 1 ") {
+			t.Errorf("%s: AddRoutes() = %v, want an error for route 1", tt.name, err)
+		}
+		if r.Len() != 1 {
+			t.Errorf("%s: %d routes installed, want only the valid one", tt.name, r.Len())
+		}
+	}
+}
+
+func TestConcurrentLookupsAndInserts(t *testing.T) {
+	r := NewRouter()
+	iface := testIface(t, 0, "eth0", "10.0.0.2/8")
+	if err := r.AddRoutes(0, &Route{iface: iface, Dst: "default"}); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 1000 {
+				dst := net.IPv4(10, byte(i>>8), byte(i), 1)
+				if _, _, _, err := r.RouteWithSrc(nil, dst); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	for i := range 1000 {
+		dst := net.IPNet{IP: net.IPv4(10, byte(i>>8), byte(i), 0).To4(), Mask: net.CIDRMask(24, 32)}
+		if err := r.AddRoutes(uint32(i), &Route{iface: iface, Dst: dst.String()}); err != nil {
+			t.Fatal(err)
+		}
+		if i%100 == 0 {
+			r.Update()
+		}
+	}
+	wg.Wait()
+	if got := r.LenV4(); got != 1001 {
+		t.Errorf("LenV4() = %d, want 1001", got)
+	}
+}
+
+func TestRouteHostForms(t *testing.T) {
+	tests := []struct {
+		src, dst string
+		wantSrc  string
+		wantDst  string
+	}{
+		{"", "172.16.1.5", "<nil>", "172.16.1.5/32"},
+		{"", "172.16.1.5/32", "<nil>", "172.16.1.5/32"},
+		{"10.0.0.1", "172.16.1.0/24", "10.0.0.1/32", "172.16.1.0/24"},
+		{"10.0.0.0/8", "172.16.1.5", "10.0.0.0/8", "172.16.1.5/32"},
+		{"", "2001:db8::5", "<nil>", "2001:db8::5/128"},
+		{"", "2001:db8::5/128", "<nil>", "2001:db8::5/128"},
+		{"2001:db8:1::1", "2001:db8::/32", "2001:db8:1::1/128", "2001:db8::/32"},
+		{"2001:db8:1::/48", "2001:db8::5", "2001:db8:1::/48", "2001:db8::5/128"},
+	}
+	for _, tt := range tests {
+		route := &Route{iface: testIface(t, 0, "eth0"), Src: tt.src, Dst: tt.dst}
+		if got := route.SrcNet().String(); got != tt.wantSrc {
+			t.Errorf("Src %q: SrcNet() = %s, want %s", tt.src, got, tt.wantSrc)
+		}
+		if got := route.DstNet().String(); got != tt.wantDst {
+			t.Errorf("Dst %q: DstNet() = %s, want %s", tt.dst, got, tt.wantDst)
+		}
+		r := NewRouter()
+		if err := r.AddRoutes(0, route); err != nil {
+			t.Errorf("Src %q, Dst %q: %v", tt.src, tt.dst, err)
+			continue
+		}
+		if r.Len() != 1 {
+			t.Errorf("Src %q, Dst %q: %d routes installed, want 1", tt.src, tt.dst, r.Len())
+		}
+	}
+}
+
+func TestLookupAfterRemoveInterface(t *testing.T) {
+	r := NewRouter()
+	eth0 := testIface(t, 0, "eth0", "192.168.1.2/24")
+	eth1 := testIface(t, 1, "eth1", "10.0.0.2/8")
+	if err := r.AddRoutes(0,
+		&Route{iface: eth0, Dst: "192.168.0.0/16"},
+		&Route{iface: eth0, Dst: "172.16.0.0/12"},
+		&Route{iface: eth1, Dst: "10.0.0.0/8"},
+	); err != nil {
+		t.Fatal(err)
+	}
+	if n := r.RemoveInterface(0); n != 2 {
+		t.Errorf("RemoveInterface(0) = %d, want 2", n)
+	}
+	if _, _, _, err := r.RouteWithSrc(nil, net.ParseIP("192.168.1.7")); !errors.Is(err, ErrNoRoute) {
+		t.Errorf("RouteWithSrc after removal: err = %v, want ErrNoRoute", err)
+	}
+	if iface, _, _, err := r.RouteWithSrc(nil, net.ParseIP("10.1.1.1")); err != nil || iface != eth1 {
+		t.Errorf("RouteWithSrc via eth1 = %v, %v, want eth1", iface, err)
+	}
+}
+
+func TestRouteWithSrcDanglingInterface(t *testing.T) {
+	r := NewRouter()
+	if err := r.AddRoutes(0, &Route{iface: testIface(t, 3, "eth3", "10.0.0.2/8"), Dst: "10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	r.mu.Lock()
+	r.deleteInterface(3) // leave the route referencing a missing interface
+	r.mu.Unlock()
+	_, _, _, err := r.RouteWithSrc(nil, net.ParseIP("10.1.1.1"))
+	if err == nil || err.Error() != "route references unknown interface 3" {
+		t.Errorf("RouteWithSrc = %v, want the unknown interface error", err)
+	}
+	if _, _, _, err := r.RouteWithNextHop(nil, net.ParseIP("10.1.1.1")); err == nil {
+		t.Error("RouteWithNextHop succeeded via a missing interface")
+	}
+}
+
+func TestInterfaceAddressNetwork(t *testing.T) {
+	mask16 := net.CIDRMask(96+24, 8*net.IPv6len) // 255.255.255.0 in 16 bytes
+	tests := []struct {
+		ip      net.IP
+		mask    net.IPMask
+		want    string
+		in, out []string
+	}{
+		{net.ParseIP("192.168.1.7").To4(), net.IPv4Mask(255, 255, 255, 0), "192.168.1.0/24", []string{"192.168.1.200", "::ffff:192.168.1.1"}, []string{"192.168.2.1"}},
+		{net.ParseIP("192.168.1.7"), mask16, "192.168.1.0/24", []string{"192.168.1.200"}, []string{"192.168.2.1"}},
+		{net.ParseIP("192.168.1.7").To4(), mask16, "192.168.1.0/24", []string{"192.168.1.200"}, []string{"192.168.2.1"}},
+		{net.ParseIP("192.168.1.7"), net.IPv4Mask(255, 255, 255, 0), "192.168.1.0/24", []string{"192.168.1.200"}, []string{"192.168.2.1"}},
+		{net.ParseIP("10.0.0.1").To4(), net.CIDRMask(32, 32), "10.0.0.1/32", []string{"10.0.0.1"}, []string{"10.0.0.2", "10.0.0.0"}},
+		{net.ParseIP("10.0.0.1"), net.CIDRMask(96+32, 8*net.IPv6len), "10.0.0.1/32", []string{"10.0.0.1"}, []string{"10.0.0.2"}},
+		{net.ParseIP("2001:db8::7"), net.CIDRMask(64, 128), "2001:db8::/64", []string{"2001:db8::1"}, []string{"2001:db8:1::1", "192.168.1.1"}},
+		{net.ParseIP("2001:db8::7"), net.IPv4Mask(255, 255, 255, 0), "<nil>", nil, []string{"2001:db8::7"}},
+	}
+	for _, tt := range tests {
+		a := &InterfaceAddress{IP: tt.ip, Netmask: tt.mask}
+		if got := a.Network().String(); got != tt.want {
+			t.Errorf("%v mask %v: Network() = %s, want %s", tt.ip, tt.mask, got, tt.want)
+		}
+		for _, s := range tt.in {
+			if !a.Contains(net.ParseIP(s)) {
+				t.Errorf("%v mask %v: Contains(%s) = false", tt.ip, tt.mask, s)
+			}
+		}
+		for _, s := range tt.out {
+			if a.Contains(net.ParseIP(s)) {
+				t.Errorf("%v mask %v: Contains(%s) = true", tt.ip, tt.mask, s)
+			}
+		}
+	}
+}
+
+func TestIPv4MappedInputs(t *testing.T) {
+	r := NewRouter()
+	eth0 := testIface(t, 0, "eth0", "192.168.1.2/24")
+	eth1 := testIface(t, 1, "eth1", "2001:db8::2/64")
+	if err := r.AddRoutes(0,
+		&Route{iface: eth0, Dst: "::ffff:0:0/96", NextHop: "::ffff:192.168.1.1"},
+		&Route{iface: eth1, Dst: "::/0"},
+	); err != nil {
+		t.Fatal(err)
+	}
+	if r.LenV4() != 1 || r.V4Route()[0].Dst.String() != "0.0.0.0/0" {
+		t.Fatalf("::ffff:0:0/96 stored as %v, want 0.0.0.0/0 among the IPv4 routes", r.V4Route())
+	}
+	for _, dst := range []string{"::ffff:1.2.3.4", "::ffff:0:0", "::ffff:255.255.255.255"} {
+		iface, addr, nh, err := r.RouteWithSrc(net.ParseIP("::ffff:192.168.1.2"), net.ParseIP(dst))
+		if err != nil || iface != eth0 || addr.IP.String() != "192.168.1.2" || nh.Gateway.String() != "192.168.1.1" {
+			t.Errorf("RouteWithSrc(%s) = %v, %v, %v, %v, want eth0 via 192.168.1.1", dst, iface, addr, nh, err)
+		}
+	}
+
+	r6 := NewRouter()
+	if err := r6.AddRoutes(0, &Route{iface: eth1, Dst: "::/0"}); err != nil {
+		t.Fatal(err)
+	}
+	if rt, err := r6.Lookup(nil, net.ParseIP("::ffff:1.2.3.4")); !errors.Is(err, ErrNoRoute) {
+		t.Errorf("::/0 matched a mapped address: %v, %v", rt, err)
+	}
+}
+
+func TestHostRoutes128(t *testing.T) {
+	tests := []struct {
+		dst    string
+		v6     bool
+		stored string
+		match  string
+	}{
+		{"2001:db8::5", true, "2001:db8::5/128", "2001:db8::5"},
+		{"2001:db8::5/128", true, "2001:db8::5/128", "2001:db8::5"},
+		{"fe80::1", true, "fe80::1/128", "fe80::1"},
+		{"::1/128", true, "::1/128", "::1"},
+		{"::ffff:192.0.2.5", false, "192.0.2.5/32", "192.0.2.5"},
+		{"::ffff:192.0.2.5/128", false, "192.0.2.5/32", "::ffff:192.0.2.5"},
+	}
+	for _, tt := range tests {
+		r := NewRouter()
+		route := &Route{iface: testIface(t, 0, "eth0", "2001:db8::2/64", "192.0.2.2/24"), Dst: tt.dst}
+		if err := r.AddRoutes(0, route); err != nil {
+			t.Fatalf("%s: %v", tt.dst, err)
+		}
+		routes, other := r.V4Route(), r.V6Route()
+		if tt.v6 {
+			routes, other = other, routes
+		}
+		if len(routes) != 1 || len(other) != 0 || routes[0].Dst.String() != tt.stored {
+			t.Errorf("%s: stored as IPv4 %v, IPv6 %v, want only %s", tt.dst, r.V4Route(), r.V6Route(), tt.stored)
+			continue
+		}
+		if rt, err := r.Lookup(nil, net.ParseIP(tt.match)); err != nil || rt != routes[0] {
+			t.Errorf("%s: Lookup(%s) = %v, %v", tt.dst, tt.match, rt, err)
+		}
+		if rt, err := r.Lookup(nil, net.ParseIP(tt.match).Mask(net.CIDRMask(120, 128))); err == nil {
+			t.Errorf("%s: host route matched another address: %v", tt.dst, rt)
+		}
+	}
+}
+
+func TestNormalizeNetRejectsMalformed(t *testing.T) {
+	for _, n := range []*net.IPNet{
+		{IP: net.ParseIP("2001:db8::5"), Mask: net.CIDRMask(32, 32)},
+		{IP: net.ParseIP("10.0.0.0").To4(), Mask: net.IPv4Mask(255, 0, 255, 0)},
+		{IP: net.ParseIP("2001:db8::"), Mask: net.IPMask(net.ParseIP("ffff::ffff"))},
+		{IP: net.IP{1, 2, 3}, Mask: net.CIDRMask(24, 32)},
+	} {
+		if got := normalizeNet(n); got != nil {
+			t.Errorf("normalizeNet(%v/%v) = %v, want nil", n.IP, n.Mask, got)
+		}
+	}
+}
+
+func TestDefaultRouteSortsLast(t *testing.T) {
+	byPriority := func(a, b *RTInfo) bool { return a.Priority < b.Priority }
+	for _, opts := range [][]Option{nil, {WithComparator(byPriority)}} {
+		r := NewRouter(opts...)
+		eth0 := testIface(t, 0, "eth0", "192.168.1.2/24")
+		eth1 := testIface(t, 1, "eth1", "10.0.0.2/8")
+		if err := r.AddRoutes(0,
+			&Route{iface: eth0, Dst: "default", Priority: 0},
+			&Route{iface: eth1, Dst: "10.0.0.0/8", Priority: 100},
+		); err != nil {
+			t.Fatal(err)
+		}
+		rt, err := r.Lookup(nil, net.ParseIP("10.1.2.3"))
+		if err != nil || rt.Iface != 1 || rt.IsDefault() {
+			t.Errorf("comparator %v: Lookup(10.1.2.3) = %v, %v, want 10.0.0.0/8", opts != nil, rt, err)
+		}
+		rt, err = r.Lookup(nil, net.ParseIP("8.8.8.8"))
+		if err != nil || !rt.IsDefault() {
+			t.Errorf("comparator %v: Lookup(8.8.8.8) = %v, %v, want the default route", opts != nil, rt, err)
+		}
+		if routes := r.V4Route(); !routes[len(routes)-1].IsDefault() || routes[0].IsDefault() {
+			t.Errorf("comparator %v: V4Route() = %v, want the default route last", opts != nil, routes)
+		}
+	}
+}
+
+func TestDefaultRouteMatchesLookup(t *testing.T) {
+	r := NewRouter()
+	if err := r.AddRoutes(0,
+		&Route{iface: testIface(t, 0, "eth0", "192.168.1.2/24"), Dst: "default", AdminDistance: 100, Priority: 0},
+		&Route{iface: testIface(t, 1, "eth1", "10.0.0.2/8"), Dst: "default", AdminDistance: 1, Priority: 10},
+		&Route{iface: testIface(t, 2, "eth2", "172.16.0.2/12"), Src: "10.9.0.0/16", Dst: "default"},
+	); err != nil {
+		t.Fatal(err)
+	}
+	want, err := r.Lookup(net.IPv4zero, net.IPv4zero)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want.Iface != 1 {
+		t.Errorf("Lookup(0.0.0.0) = %v, want the AdminDistance 1 route", want)
+	}
+	if got, ok := r.DefaultRouteV4(); !ok || got != want {
+		t.Errorf("DefaultRouteV4() = %v, %v, want %v as picked by Lookup", got, ok, want)
+	}
+}
+
+func TestAdminDistanceRanksAheadOfPriority(t *testing.T) {
+	r := NewRouter()
+	eth0 := testIface(t, 0, "eth0", "192.168.1.2/24", "2001:db8:1::2/64")
+	eth1 := testIface(t, 1, "eth1", "10.0.0.2/8", "2001:db8:2::2/64")
+	for _, dst := range []string{"0.0.0.0/0", "::/0", "172.16.0.0/12"} {
+		if err := r.AddRoutes(0,
+			&Route{iface: eth0, Dst: dst, AdminDistance: 100, Priority: 0},
+			&Route{iface: eth1, Dst: dst, AdminDistance: 1, Priority: 10},
+		); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, dst := range []string{"8.8.8.8", "2001:db8:9::1", "172.16.1.1"} {
+		if rt, err := r.Lookup(nil, net.ParseIP(dst)); err != nil || rt.Iface != 1 {
+			t.Errorf("Lookup(%s) = %v, %v, want the route via eth1", dst, rt, err)
+		}
+	}
+	if rt, ok := r.DefaultRouteV4(); !ok || rt.Iface != 1 {
+		t.Errorf("DefaultRouteV4() = %v, %v, want the route via eth1", rt, ok)
+	}
+	if rt, ok := r.DefaultRouteV6(); !ok || rt.Iface != 1 {
+		t.Errorf("DefaultRouteV6() = %v, %v, want the route via eth1", rt, ok)
+	}
+	_, n, _ := net.ParseCIDR("172.16.0.0/12")
+	if rt, ok := r.GetRoute(n); !ok || rt.Iface != 1 {
+		t.Errorf("GetRoute(%v) = %v, %v, want the route via eth1", n, rt, ok)
+	}
+}
+
+func TestSwapRoutesLeavesInputs(t *testing.T) {
+	r := NewRouter()
+	if err := r.AddInterface(testIface(t, 0, "eth0", "10.0.0.2/8")); err != nil {
+		t.Fatal(err)
+	}
+	_, dst, _ := net.ParseCIDR("::ffff:10.1.0.0/112") // normalized to 10.1.0.0/16 when installed
+	in := &RTInfo{Dst: dst, Selector: FirstAddressSelector}
+	dangling := &RTInfo{Dst: anyPrefix(net.IPv4len), Selector: FirstAddressSelector, Iface: 7}
+	if err := r.SwapRoutes([]*RTInfo{in, dangling}, nil); err == nil {
+		t.Fatal("SwapRoutes accepted a route via an unknown interface")
+	}
+	if in.Dst != dst || in.Weight != 0 || r.Len() != 0 {
+		t.Errorf("failed swap changed its input to %v weight %d or installed %d routes", in.Dst, in.Weight, r.Len())
+	}
+	if err := r.SwapRoutes([]*RTInfo{in}, nil); err != nil {
+		t.Fatal(err)
+	}
+	got := r.V4Route()[0]
+	if got == in || in.Dst != dst || in.Weight != 0 {
+		t.Errorf("SwapRoutes installed or changed its input: %v weight %d", in.Dst, in.Weight)
+	}
+	if got.Dst.String() != "10.1.0.0/16" || got.Weight != 1 {
+		t.Errorf("installed %v weight %d, want 10.1.0.0/16 weight 1", got.Dst, got.Weight)
+	}
+}
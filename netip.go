@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+)
+
+// AddPrefix is AddRoute for a route built from netip values. An invalid src
+// prefix matches any source and an invalid nextHop leaves the route without
+// one.
+func (r *Router) AddPrefix(priority uint32, iface *Interface, src, dst netip.Prefix, nextHop netip.Addr) (*RTInfo, error) {
+	if iface == nil {
+		return nil, errors.New("route has no interface")
+	}
+	if !dst.IsValid() {
+		return nil, errors.New("invalid destination prefix")
+	}
+	route := &Route{iface: iface, Dst: dst.Masked().String()}
+	if src.IsValid() {
+		route.Src = src.Masked().String()
+	}
+	if nextHop.IsValid() {
+		route.NextHop = nextHop.WithZone("").Unmap().String()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.addRoute(r.main, priority, route)
+}
+
+// LookupAddr is Lookup for netip addresses. IPv4-mapped addresses are matched
+// against the IPv4 table, as with net.IP. The zone of a link-local dst limits
+// the match to routes via the interface it names, see Interface.InZone. The
+// addresses are copied into stack buffers, so the lookup itself does not
+// allocate.
+func (r *Router) LookupAddr(src, dst netip.Addr) (*RTInfo, error) {
+	if !dst.IsValid() {
+		return nil, ErrInvalidIP
+	}
+	var srcBuf, dstBuf [net.IPv6len]byte
+	q := query{src: addrToIP(srcBuf[:0], src), dst: addrToIP(dstBuf[:0], dst), zone: dst.Zone()}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.routeTables([]*table{r.main}, q)
+}
+
+// RouteAddr is RouteWithSrc for netip addresses, honoring the zone of a
+// link-local dst like LookupAddr.
+func (r *Router) RouteAddr(src, dst netip.Addr) (iface *Interface, preferredSrc *InterfaceAddress, nextHop NextHop, err error) {
+	if !dst.IsValid() {
+		err = ErrInvalidIP
+		return
+	}
+	q := query{src: addrToIP(nil, src), dst: addrToIP(nil, dst), zone: dst.Zone()}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res, err := r.resolve(context.Background(), r.main, q, 0)
+	if err != nil {
+		return
+	}
+	return res.iface, res.addr, res.nextHop, nil
+}
+
+// addrToIP appends a in its natural byte length to buf. An invalid address
+// yields nil.
+func addrToIP(buf []byte, a netip.Addr) net.IP {
+	a = a.Unmap()
+	switch {
+	case a.Is4():
+		b := a.As4()
+		return append(buf, b[:]...)
+	case a.Is6():
+		b := a.As16()
+		return append(buf, b[:]...)
+	}
+	return nil
+}
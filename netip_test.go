@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestLinkLocalZones(t *testing.T) {
+	r := NewRouter()
+	eth0 := testIface(t, 0, "eth0", "fe80::1/64")
+	eth1 := testIface(t, 1, "eth1", "fe80::2/64")
+	eth1.addrs[0].Zone = "wlan" // an address zone names the interface too
+	for _, iface := range []*Interface{eth0, eth1} {
+		if err := r.AddRoutes(0, &Route{iface: iface, Dst: "fe80::/64"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		dst       string
+		wantIface *Interface
+		wantAddr  string
+	}{
+		{"fe80::99%eth0", eth0, "fe80::1"},
+		{"fe80::99%eth1", eth1, "fe80::2"},
+		{"fe80::99%wlan", eth1, "fe80::2"},
+	}
+	for _, tt := range tests {
+		dst := netip.MustParseAddr(tt.dst)
+		rt, err := r.LookupAddr(netip.Addr{}, dst)
+		if err != nil || rt.Iface != tt.wantIface.Id {
+			t.Errorf("LookupAddr(%s) = %v, %v, want a route via %s", tt.dst, rt, err, tt.wantIface.Name)
+		}
+		iface, addr, _, err := r.RouteAddr(netip.Addr{}, dst)
+		if err != nil || iface != tt.wantIface || addr.IP.String() != tt.wantAddr {
+			t.Errorf("RouteAddr(%s) = %v, %v, %v, want %s and %s", tt.dst, iface, addr, err, tt.wantIface.Name, tt.wantAddr)
+		}
+	}
+	if rt, err := r.LookupAddr(netip.Addr{}, netip.MustParseAddr("fe80::99%eth2")); err == nil {
+		t.Errorf("LookupAddr in an unknown zone = %v, want an error", rt)
+	}
+}
@@ -0,0 +1,221 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// LoadFromNetlink builds a Router from the kernel's routing tables, read
+// over rtnetlink like `ip route show table all` does. Interfaces keep their
+// kernel index as Id, their name and MTU, are down unless flagged up, and
+// carry their addresses, deprecated and tentative ones marked. Every table is
+// imported under its own id; unicast, blackhole, unreachable and prohibit
+// routes are kept and the local, broadcast and other kernel-managed types
+// skipped. Each hop of a multipath route becomes its own route, keeping its
+// weight and onlink flag, and the route metric becomes its Priority.
+func LoadFromNetlink() (*Router, error) {
+	netIfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	r := NewRouter()
+	for _, ni := range netIfaces {
+		iface := &Interface{Id: int64(ni.Index), Name: ni.Name, MTU: ni.MTU, down: ni.Flags&net.FlagUp == 0}
+		r.setInterface(iface)
+	}
+
+	msgs, err := netlinkDump(syscall.RTM_GETADDR)
+	if err != nil {
+		return nil, fmt.Errorf("addresses: %w", err)
+	}
+	for _, m := range msgs {
+		if m.Header.Type != syscall.RTM_NEWADDR {
+			continue
+		}
+		if err := r.addNetlinkAddress(m.Data); err != nil {
+			return nil, fmt.Errorf("address: %w", err)
+		}
+	}
+
+	msgs, err = netlinkDump(syscall.RTM_GETROUTE)
+	if err != nil {
+		return nil, fmt.Errorf("routes: %w", err)
+	}
+	for _, m := range msgs {
+		if m.Header.Type != syscall.RTM_NEWROUTE {
+			continue
+		}
+		if err := r.addNetlinkRoute(m.Data); err != nil {
+			return nil, fmt.Errorf("route: %w", err)
+		}
+	}
+	return r, nil
+}
+
+// ifaFlags is IFA_FLAGS, the attribute holding the full 32 address flags,
+// which package syscall predates.
+const ifaFlags = 8
+
+// netlinkDump runs a dump request of type typ for both families.
+func netlinkDump(typ int) ([]syscall.NetlinkMessage, error) {
+	rib, err := syscall.NetlinkRIB(typ, syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, err
+	}
+	return syscall.ParseNetlinkMessage(rib)
+}
+
+// addNetlinkAddress records the address of an RTM_NEWADDR message, an
+// ifaddrmsg followed by attributes, on its interface. The broadcast address
+// is kept as the kernel reports it, which need not be the computed one, e.g.
+// after `ip addr add ... brd` or on a /31, so AddAddress is bypassed.
+func (r *Router) addNetlinkAddress(data []byte) error {
+	if len(data) < syscall.SizeofIfAddrmsg {
+		return fmt.Errorf("short message of %d bytes", len(data))
+	}
+	prefixLen, flags := int(data[1]), uint32(data[2])
+	index := int64(binary.NativeEndian.Uint32(data[4:8]))
+	attrs := netlinkAttrs(data[syscall.SizeofIfAddrmsg:])
+	if f, ok := attrs[ifaFlags]; ok && len(f) == 4 {
+		flags = binary.NativeEndian.Uint32(f)
+	}
+	ip := net.IP(attrs[syscall.IFA_LOCAL]) // the peer's on point-to-point links
+	if ip == nil {
+		ip = net.IP(attrs[syscall.IFA_ADDRESS])
+	}
+	iface := r.ifaces[index]
+	if iface == nil || ip == nil {
+		return nil
+	}
+	a := &InterfaceAddress{
+		IP:         ip,
+		Netmask:    net.CIDRMask(prefixLen, 8*len(ip)),
+		Deprecated: flags&syscall.IFA_F_DEPRECATED != 0,
+		Tentative:  flags&syscall.IFA_F_TENTATIVE != 0,
+	}
+	if b, ok := attrs[syscall.IFA_BROADCAST]; ok {
+		a.Broadaddr = net.IP(b)
+	}
+	iface.addrs = append(iface.addrs, a)
+	return nil
+}
+
+// netlinkRouteTypes maps the rtnetlink route types LoadFromNetlink imports.
+var netlinkRouteTypes = map[uint8]RouteType{
+	syscall.RTN_UNICAST:     RouteUnicast,
+	syscall.RTN_BLACKHOLE:   RouteBlackhole,
+	syscall.RTN_UNREACHABLE: RouteUnreachable,
+	syscall.RTN_PROHIBIT:    RouteProhibit,
+}
+
+// addNetlinkRoute installs the route of an RTM_NEWROUTE message, an rtmsg
+// followed by attributes.
+func (r *Router) addNetlinkRoute(data []byte) error {
+	if len(data) < syscall.SizeofRtMsg {
+		return fmt.Errorf("short message of %d bytes", len(data))
+	}
+	family, dstLen, srcLen := data[0], int(data[1]), int(data[2])
+	id, scope, rtmType := int(data[4]), data[6], data[7]
+	flags := binary.NativeEndian.Uint32(data[8:12])
+	typ, ok := netlinkRouteTypes[rtmType]
+	if !ok || family != syscall.AF_INET && family != syscall.AF_INET6 {
+		return nil
+	}
+	attrs := netlinkAttrs(data[syscall.SizeofRtMsg:])
+	if t, ok := attrs[syscall.RTA_TABLE]; ok && len(t) == 4 {
+		id = int(binary.NativeEndian.Uint32(t))
+	}
+	ipLen := net.IPv4len
+	if family == syscall.AF_INET6 {
+		ipLen = net.IPv6len
+	}
+	route := &Route{
+		Dst:  netlinkPrefix(attrs[syscall.RTA_DST], dstLen, ipLen),
+		Type: typ,
+	}
+	if srcLen > 0 {
+		route.Src = netlinkPrefix(attrs[syscall.RTA_SRC], srcLen, ipLen)
+	}
+	if p, ok := attrs[syscall.RTA_PRIORITY]; ok && len(p) == 4 {
+		route.Priority = binary.NativeEndian.Uint32(p)
+	}
+	switch scope {
+	case syscall.RT_SCOPE_LINK:
+		route.Scope = ScopeLink
+	case syscall.RT_SCOPE_HOST:
+		route.Scope = ScopeHost
+	}
+	if r.tables[id] == nil {
+		r.tables[id] = &table{id: id}
+	}
+	t := r.tables[id]
+
+	type hop struct {
+		oif     []byte
+		gateway net.IP
+		flags   uint32
+		weight  uint32
+	}
+	hops := []hop{{attrs[syscall.RTA_OIF], net.IP(attrs[syscall.RTA_GATEWAY]), flags, 1}}
+	if mp, ok := attrs[syscall.RTA_MULTIPATH]; ok {
+		hops = hops[:0]
+		for len(mp) >= 8 { // struct rtnexthop
+			n := int(binary.NativeEndian.Uint16(mp[0:2]))
+			if n < 8 || n > len(mp) {
+				return fmt.Errorf("route %s: malformed nexthop", route.Dst)
+			}
+			nhAttrs := netlinkAttrs(mp[8:n])
+			hops = append(hops, hop{mp[4:8], net.IP(nhAttrs[syscall.RTA_GATEWAY]), uint32(mp[2]), uint32(mp[3]) + 1})
+			mp = mp[min(netlinkAlign(n), len(mp)):]
+		}
+	}
+	for _, h := range hops {
+		hr := *route
+		if typ == RouteUnicast {
+			if len(h.oif) != 4 || r.ifaces[int64(binary.NativeEndian.Uint32(h.oif))] == nil {
+				continue // e.g. a route via a nexthop object
+			}
+			hr.iface = r.ifaces[int64(binary.NativeEndian.Uint32(h.oif))]
+		}
+		if h.gateway != nil {
+			hr.NextHop = h.gateway.String()
+		}
+		hr.Onlink = h.flags&syscall.RTNH_F_ONLINK != 0
+		hr.Weight = h.weight
+		if _, err := r.addRoute(t, 0, &hr); err != nil {
+			return fmt.Errorf("route %s: %w", route.Dst, err)
+		}
+	}
+	return nil
+}
+
+// netlinkPrefix writes the prefix of ones bits at addr, an address of ipLen
+// bytes that is absent for a /0.
+func netlinkPrefix(addr []byte, ones, ipLen int) string {
+	ip := make(net.IP, ipLen)
+	copy(ip, addr)
+	return (&net.IPNet{IP: ip, Mask: net.CIDRMask(ones, 8*ipLen)}).String()
+}
+
+// netlinkAttrs splits a run of rtattrs by type. Truncated attributes end the
+// run.
+func netlinkAttrs(b []byte) map[uint16][]byte {
+	attrs := make(map[uint16][]byte)
+	for len(b) >= 4 {
+		n := int(binary.NativeEndian.Uint16(b[0:2]))
+		if n < 4 || n > len(b) {
+			break
+		}
+		attrs[binary.NativeEndian.Uint16(b[2:4])] = b[4:n]
+		b = b[min(netlinkAlign(n), len(b)):]
+	}
+	return attrs
+}
+
+func netlinkAlign(n int) int {
+	return (n + syscall.NLMSG_ALIGNTO - 1) &^ (syscall.NLMSG_ALIGNTO - 1)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PortRange is an inclusive range of ports. The zero PortRange matches any
+// port.
+type PortRange struct {
+	First, Last uint16
+}
+
+// Ports returns the range of the single port p.
+func Ports(p uint16) PortRange {
+	return PortRange{First: p, Last: p}
+}
+
+func (p PortRange) String() string {
+	if p.First == p.Last {
+		return fmt.Sprint(p.First)
+	}
+	return fmt.Sprintf("%d-%d", p.First, p.Last)
+}
+
+func (p PortRange) any() bool {
+	return p == PortRange{}
+}
+
+func (p PortRange) contains(port uint16) bool {
+	return p.any() || p.First <= port && port <= p.Last
+}
+
+// matchesFlow reports whether q's flow meets rt's Mark, Proto and DstPorts.
+// A lookup that gives no protocol only matches routes without the latter two.
+func (rt *RTInfo) matchesFlow(q query) bool {
+	if rt.Mark != 0 && rt.Mark != q.mark {
+		return false
+	}
+	if rt.Proto == 0 && rt.DstPorts.any() {
+		return true
+	}
+	return q.proto != 0 && (rt.Proto == 0 || rt.Proto == q.proto) && rt.DstPorts.contains(q.dport)
+}
+
+// flowBits counts rt's flow match criteria. Like a longer prefix, a route
+// with more criteria is the more specific one.
+func flowBits(rt *RTInfo) int {
+	n := 0
+	if rt.Proto != 0 {
+		n++
+	}
+	if !rt.DstPorts.any() {
+		n++
+	}
+	if rt.Mark != 0 {
+		n++
+	}
+	return n
+}
+
+// RouteFlow is RouteWithSrc for f.Src to f.Dst, matching routes by the flow's
+// mark, protocol and destination port as well, e.g. to send TCP/443 out of another
+// interface than the rest. Any next hop is resolved without those criteria.
+func (r *Router) RouteFlow(f Flow) (iface *Interface, preferredSrc *InterfaceAddress, nextHop NextHop, err error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res, err := r.resolve(context.Background(), r.main, query{src: f.Src, dst: f.Dst, proto: f.Proto, sport: f.SrcPort, dport: f.DstPort, mark: f.Mark}, 0)
+	if err != nil {
+		return
+	}
+	return res.iface, res.addr, res.nextHop, nil
+}
+
+// parsePortRange parses a PortRange written by its String method.
+func parsePortRange(s string) (PortRange, error) {
+	first, last, ok := strings.Cut(s, "-")
+	if !ok {
+		last = first
+	}
+	a, err1 := strconv.ParseUint(first, 10, 16)
+	b, err2 := strconv.ParseUint(last, 10, 16)
+	if err1 != nil || err2 != nil || b < a {
+		return PortRange{}, fmt.Errorf("invalid port range %q", s)
+	}
+	return PortRange{First: uint16(a), Last: uint16(b)}, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Flags from the Flags column of /proc/net/route.
+const (
+	rtfUp      = 0x0001
+	rtfGateway = 0x0002
+	rtfReject  = 0x0200
+)
+
+// LoadProcNetRoute builds a Router from a Linux /proc/net/route file.
+// Interfaces are created per distinct Iface column, numbered in order of
+// appearance, and carry no addresses; Metric becomes the route Priority.
+// Routes not flagged up are skipped and reject routes become unreachable
+// routes without an interface.
+func LoadProcNetRoute(path string) (*Router, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseProcNetRoute(f)
+}
+
+// ParseProcNetRoute is LoadProcNetRoute reading from rd.
+func ParseProcNetRoute(rd io.Reader) (*Router, error) {
+	r := NewRouter()
+	ifaces := make(map[string]*Interface)
+	sc := bufio.NewScanner(rd)
+	for line := 1; sc.Scan(); line++ {
+		fields := strings.Fields(sc.Text())
+		if line == 1 || len(fields) == 0 {
+			continue // header
+		}
+		if len(fields) < 8 {
+			return nil, fmt.Errorf("line %d: expected at least 8 fields, got %d", line, len(fields))
+		}
+		dst, err := procHexIP(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: destination: %w", line, err)
+		}
+		gw, err := procHexIP(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: gateway: %w", line, err)
+		}
+		flags, err := strconv.ParseUint(fields[3], 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: flags: %w", line, err)
+		}
+		metric, err := strconv.ParseUint(fields[6], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: metric: %w", line, err)
+		}
+		mask, err := procHexIP(fields[7])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: mask: %w", line, err)
+		}
+		if flags&rtfUp == 0 {
+			continue
+		}
+		ones, bits := net.IPMask(mask).Size()
+		if bits == 0 {
+			return nil, fmt.Errorf("line %d: non-contiguous mask %v", line, mask)
+		}
+
+		route := &Route{
+			Dst:      fmt.Sprintf("%v/%d", dst, ones),
+			Priority: uint32(metric),
+		}
+		if flags&rtfReject != 0 {
+			route.Type = RouteUnreachable
+		} else {
+			iface := ifaces[fields[0]]
+			if iface == nil {
+				iface = &Interface{Id: int64(len(ifaces)), Name: fields[0]}
+				ifaces[fields[0]] = iface
+			}
+			route.iface = iface
+		}
+		if flags&rtfGateway != 0 {
+			route.NextHop = gw.String()
+		}
+		if _, err := r.AddRoute(0, route); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// procHexIP decodes an IPv4 address written as the little-endian hex of its
+// 32-bit value, as in /proc/net/route.
+func procHexIP(s string) (net.IP, error) {
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return nil, err
+	}
+	ip := make(net.IP, net.IPv4len)
+	binary.LittleEndian.PutUint32(ip, uint32(v))
+	return ip, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net"
+	"net/netip"
+)
+
+// RFC6724Selector picks the source address a host would use for dst following
+// the source selection rules of RFC 6724 section 5 that apply to a single
+// interface: prefer the destination itself (rule 1), an appropriate scope
+// (rule 2), an address that is not deprecated or tentative (rule 3), a
+// matching policy label (rule 6) and finally the longest prefix shared with
+// dst (rule 8). Addresses of the other family are only used when
+// the interface has none of dst's family.
+func RFC6724Selector(a []*InterfaceAddress, src, dst net.IP) *InterfaceAddress {
+	d, ok := netip.AddrFromSlice(dst)
+	if !ok {
+		return FirstAddressSelector(a, src, dst)
+	}
+	var best *InterfaceAddress
+	for _, addr := range a {
+		if best == nil || rfc6724Prefer(addr, best, d) {
+			best = addr
+		}
+	}
+	return best
+}
+
+// rfc6724Prefer reports whether sa is strictly preferred over sb as the
+// source for d.
+func rfc6724Prefer(sa, sb *InterfaceAddress, d netip.Addr) bool {
+	a, _ := netip.AddrFromSlice(sa.IP)
+	b, _ := netip.AddrFromSlice(sb.IP)
+	a, b, d = a.Unmap(), b.Unmap(), d.Unmap()
+
+	if famA, famB := a.Is4() == d.Is4(), b.Is4() == d.Is4(); famA != famB {
+		return famA
+	}
+	// Rule 1: prefer same address.
+	if eqA, eqB := a == d, b == d; eqA != eqB {
+		return eqA
+	}
+	// Rule 2: prefer appropriate scope.
+	if scA, scB, scD := addrScope(a), addrScope(b), addrScope(d); scA != scB {
+		if scA < scB {
+			return scA >= scD
+		}
+		return scB < scD
+	}
+	// Rule 3: avoid deprecated addresses, and tentative ones, which RFC 6724
+	// leaves to the host.
+	if rA, rB := sa.rank(), sb.rank(); rA != rB {
+		return rA < rB
+	}
+	// Rule 6: prefer matching label.
+	if lA, lB, lD := policyLabel(a), policyLabel(b), policyLabel(d); (lA == lD) != (lB == lD) {
+		return lA == lD
+	}
+	// Rule 8: use longest matching prefix.
+	return commonPrefixLen(a, sa.Netmask, d) > commonPrefixLen(b, sb.Netmask, d)
+}
+
+const (
+	scopeLinkLocal = 0x2
+	scopeSiteLocal = 0x5
+	scopeGlobal    = 0xe
+)
+
+var siteLocalPrefix = netip.MustParsePrefix("fec0::/10")
+
+// addrScope classifies a as in RFC 6724 section 3.1, with IPv4 loopback and
+// link-local addresses mapped to link-local scope.
+func addrScope(a netip.Addr) int {
+	switch {
+	case a.Is6() && a.IsMulticast():
+		return int(a.As16()[1] & 0xf)
+	case a.IsLoopback(), a.IsLinkLocalUnicast():
+		return scopeLinkLocal
+	case siteLocalPrefix.Contains(a):
+		return scopeSiteLocal
+	}
+	return scopeGlobal
+}
+
+// policyTable is the default policy table of RFC 6724 section 2.1.
+var policyTable = []struct {
+	prefix netip.Prefix
+	label  int
+}{
+	{netip.MustParsePrefix("::1/128"), 0},
+	{netip.MustParsePrefix("::ffff:0:0/96"), 4},
+	{netip.MustParsePrefix("::/96"), 3},
+	{netip.MustParsePrefix("2001::/32"), 5},
+	{netip.MustParsePrefix("2002::/16"), 2},
+	{netip.MustParsePrefix("3ffe::/16"), 12},
+	{netip.MustParsePrefix("fec0::/10"), 11},
+	{netip.MustParsePrefix("fc00::/7"), 13},
+	{netip.MustParsePrefix("::/0"), 1},
+}
+
+// policyLabel returns the label of the longest matching policyTable entry.
+// The table is ordered longest prefix first.
+func policyLabel(a netip.Addr) int {
+	if a.Is4() {
+		a = netip.AddrFrom16(a.As16())
+	}
+	for _, p := range policyTable {
+		if p.prefix.Contains(a) {
+			return p.label
+		}
+	}
+	return 1
+}
+
+// commonPrefixLen counts the leading bits a shares with d, capped at the
+// prefix length of a's netmask.
+func commonPrefixLen(a netip.Addr, mask net.IPMask, d netip.Addr) int {
+	if a.Is4() != d.Is4() {
+		return 0
+	}
+	ab, db := a.AsSlice(), d.AsSlice()
+	n := 0
+	for i := range ab {
+		x := ab[i] ^ db[i]
+		if x == 0 {
+			n += 8
+			continue
+		}
+		for x&0x80 == 0 {
+			n++
+			x <<= 1
+		}
+		break
+	}
+	if ones, bits := mask.Size(); bits != 0 {
+		if bits == 8*net.IPv6len && a.Is4() {
+			ones -= 96
+		}
+		n = min(n, ones)
+	}
+	return n
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"slices"
+	"sort"
+)
+
+// Rule selects the table consulted for some traffic, like an `ip rule`
+// entry.
+type Rule struct {
+	Priority uint32     // rules are evaluated lowest first
+	Src      *net.IPNet // nil matches any source
+	// Mark and MarkMask match packets whose mark&MarkMask equals Mark. A
+	// zero MarkMask with a nonzero Mark compares the whole mark, as ip rule
+	// does; both zero match any mark.
+	Mark     uint32
+	MarkMask uint32
+	Table    int
+}
+
+func (ru *Rule) matches(src net.IP, mark uint32) bool {
+	if ru.Src != nil && (src == nil || !ru.Src.Contains(src)) {
+		return false
+	}
+	return mark&ru.MarkMask == ru.Mark
+}
+
+// AddRule installs rule after any existing rules of the same Priority. Its
+// table need not exist yet; a rule pointing at a missing table is skipped.
+func (r *Router) AddRule(rule Rule) error {
+	if rule.Src != nil {
+		if rule.Src = normalizeNet(rule.Src); rule.Src == nil {
+			return errors.New("invalid rule source")
+		}
+	}
+	if rule.MarkMask == 0 && rule.Mark != 0 {
+		rule.MarkMask = ^uint32(0)
+	}
+	if rule.Mark&^rule.MarkMask != 0 {
+		return errors.New("rule mark has bits outside its mask")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := sort.Search(len(r.rules), func(i int) bool { return r.rules[i].Priority > rule.Priority })
+	r.rules = slices.Insert(r.rules, i, rule)
+	return nil
+}
+
+// Rules returns a copy of the installed rules in evaluation order.
+func (r *Router) Rules() []Rule {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.rules)
+}
+
+// PolicyLookup is Lookup for a packet carrying mark, with the table chosen by
+// the rules: the tables of the matching rules are tried in order and the
+// first with a route for dst wins. The main table is tried last, standing in
+// for the main rule Linux installs by default, so without rules PolicyLookup
+// matches Lookup. A blackhole or unreachable route ends the search like any
+// other match. Routes requiring a Mark match only if it equals mark.
+func (r *Router) PolicyLookup(src, dst net.IP, mark uint32) (*RTInfo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.routeTables(r.policyTables(src, mark), query{src: src, dst: dst, mark: mark})
+}
+
+// policyTables returns the tables the rules select for src and mark, in
+// order, followed by the main table.
+func (r *Router) policyTables(src net.IP, mark uint32) []*table {
+	var tables []*table
+	for i := range r.rules {
+		if ru := &r.rules[i]; ru.matches(src, mark) && r.tables[ru.Table] != nil {
+			tables = append(tables, r.tables[ru.Table])
+		}
+	}
+	return append(tables, r.main)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+// Scope is how far a route's destination is, as in Linux: a global route
+// may lead anywhere, a link route only to hosts on the attached link and a
+// host route only to the machine itself. Narrower scopes order higher.
+type Scope uint8
+
+const (
+	ScopeGlobal Scope = iota
+	ScopeLink
+	ScopeHost
+)
+
+var scopeNames = []string{"global", "link", "host"}
+
+func (s Scope) String() string {
+	if int(s) < len(scopeNames) {
+		return scopeNames[s]
+	}
+	return fmt.Sprintf("Scope(%d)", s)
+}
+
+func parseScope(s string) (Scope, error) {
+	for i, name := range scopeNames {
+		if name == s {
+			return Scope(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown scope %q", s)
+}
+
+// LookupScope is Lookup considering only routes at least as wide as scope:
+// ScopeGlobal admits global routes only, so a link-scope route is never used
+// to reach a global destination, ScopeLink admits link routes as well and
+// ScopeHost admits every route, as Lookup does.
+func (r *Router) LookupScope(src, dst net.IP, scope Scope) (*RTInfo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.routeTables([]*table{r.main}, query{src: src, dst: dst, scope: scope, scoped: true})
+}
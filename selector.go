@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"reflect"
+	"slices"
+	"sync"
+)
+
+// builtinSelectors names the selectors of this package. They are plain
+// functions, so unlike closures they can be recognized by their code pointer.
+var builtinSelectors = map[string]InterfaceAddressSelector{
+	"first":       FirstAddressSelector,
+	"fit":         FitAddressSelector,
+	"same-subnet": SameSubnetSelector,
+	"rfc6724":     RFC6724Selector,
+}
+
+// selectors is the registry of named selectors, see RegisterSelector.
+var selectors = struct {
+	sync.RWMutex
+	byName map[string]InterfaceAddressSelector
+}{byName: maps.Clone(builtinSelectors)}
+
+// RegisterSelector names sel so that a Route can refer to it by SelectorName,
+// which is kept when the route is marshaled to JSON and resolved again when
+// it is read back. The built-in selectors are registered as "first", "fit",
+// "same-subnet" and "rfc6724". A name can be registered only once.
+func RegisterSelector(name string, sel InterfaceAddressSelector) error {
+	if name == "" || sel == nil {
+		return errors.New("selector needs a name and a function")
+	}
+	selectors.Lock()
+	defer selectors.Unlock()
+	if selectors.byName[name] != nil {
+		return fmt.Errorf("selector %q is already registered", name)
+	}
+	selectors.byName[name] = sel
+	return nil
+}
+
+// LookupSelector returns the selector registered under name.
+func LookupSelector(name string) (InterfaceAddressSelector, bool) {
+	selectors.RLock()
+	defer selectors.RUnlock()
+	sel, ok := selectors.byName[name]
+	return sel, ok
+}
+
+// nameOfSelector returns the name of sel if it is a built-in selector. Other
+// selectors may be closures sharing code, e.g. those of WeightedSelector, and
+// are only known by the SelectorName they were installed with.
+func nameOfSelector(sel InterfaceAddressSelector) (string, bool) {
+	p := reflect.ValueOf(sel).Pointer()
+	for name, s := range builtinSelectors {
+		if reflect.ValueOf(s).Pointer() == p {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// WithDefaultSelector makes routes added afterwards pick their source address
+// with sel instead of FirstAddressSelector, unless a Route sets its own
+// AddressSelector or SelectorName.
+func WithDefaultSelector(sel InterfaceAddressSelector) Option {
+	return func(r *Router) {
+		r.defaultSelector = sel
+	}
+}
+
+// SameSubnetSelector returns the first address whose subnet contains dst,
+// falling back to the first address when none does.
+func SameSubnetSelector(a []*InterfaceAddress, src, dst net.IP) *InterfaceAddress {
+	if addr := FitAddressSelector(a, src, dst); addr != nil {
+		return addr
+	}
+	return FirstAddressSelector(a, src, dst)
+}
+
+// WeightedSelector returns a selector that spreads flows over an interface's
+// addresses in proportion to weights, weights[i] applying to the i-th
+// address; addresses past the end of weights get weight 1. The choice is a
+// hash of (src, dst), so packets of one flow always get the same address.
+func WeightedSelector(weights ...uint32) InterfaceAddressSelector {
+	return WeightedSelectorHash(DefaultFlowHash, weights...)
+}
+
+// WeightedSelectorHash is WeightedSelector choosing by hash of the flow's
+// (src, dst) instead of DefaultFlowHash.
+func WeightedSelectorHash(hash FlowHashFunc, weights ...uint32) InterfaceAddressSelector {
+	weightAt := func(i int) uint64 {
+		if i < len(weights) {
+			return uint64(weights[i])
+		}
+		return 1
+	}
+	return func(a []*InterfaceAddress, src, dst net.IP) *InterfaceAddress {
+		var total uint64
+		for i := range a {
+			total += weightAt(i)
+		}
+		if total == 0 {
+			return FirstAddressSelector(a, src, dst)
+		}
+		h := hash(Flow{Src: src, Dst: dst}) % total
+		for i, addr := range a {
+			w := weightAt(i)
+			if h < w {
+				return addr
+			}
+			h -= w
+		}
+		return nil
+	}
+}
+
+// Flow identifies the packets a lookup is for, to pick among equal-cost
+// routes and weighted addresses. Proto and the ports are optional; a zero
+// Proto means only the addresses are known. Mark is the packets' firewall
+// mark, matched against Route.Mark but not hashed.
+type Flow struct {
+	Src, Dst         net.IP
+	Proto            uint8 // IP protocol number, e.g. 6 for TCP
+	SrcPort, DstPort uint16
+	Mark             uint32
+}
+
+// FlowHashFunc maps a flow to a hash. It must be deterministic so that every
+// packet of a flow takes the same path.
+type FlowHashFunc func(Flow) uint64
+
+// WithFlowHash makes ECMP picks hash flows with h instead of DefaultFlowHash,
+// e.g. to reproduce the hashing of upstream switches.
+func WithFlowHash(h FlowHashFunc) Option {
+	return func(r *Router) {
+		r.hash = h
+	}
+}
+
+// DefaultFlowHash is a stable FNV-1a based hash of the flow's addresses and,
+// when Proto is set, its protocol and ports. IPv4 addresses hash the same in
+// their 4- and 16-byte forms.
+func DefaultFlowHash(f Flow) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	h := uint64(offset64)
+	for _, ip := range [2]net.IP{f.Src.To16(), f.Dst.To16()} {
+		for _, b := range ip {
+			h ^= uint64(b)
+			h *= prime64
+		}
+	}
+	if f.Proto != 0 {
+		for _, b := range [5]byte{f.Proto, byte(f.SrcPort >> 8), byte(f.SrcPort), byte(f.DstPort >> 8), byte(f.DstPort)} {
+			h ^= uint64(b)
+			h *= prime64
+		}
+	}
+	// FNV's low bits mix poorly and callers reduce the hash modulo small
+	// counts, so finish with the murmur3 finalizer.
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// hashFlow hashes q's flow with the router's FlowHashFunc.
+func (r *Router) hashFlow(q query) uint64 {
+	if r.hash != nil {
+		// Clone so the addresses do not escape; LookupAddr passes stack
+		// buffers.
+		return r.hash(Flow{Src: slices.Clone(q.src), Dst: slices.Clone(q.dst), Proto: q.proto, SrcPort: q.sport, DstPort: q.dport})
+	}
+	return DefaultFlowHash(Flow{Src: q.src, Dst: q.dst, Proto: q.proto, SrcPort: q.sport, DstPort: q.dport})
+}
+
+// LookupFlow is Lookup for f.Src to f.Dst, picking among equal-cost routes
+// by the hash of the whole flow. Routes with a Mark, Proto or DstPorts only
+// match flows that meet them.
+func (r *Router) LookupFlow(f Flow) (*RTInfo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.routeTables([]*table{r.main}, query{src: f.Src, dst: f.Dst, proto: f.Proto, sport: f.SrcPort, dport: f.DstPort, mark: f.Mark})
+}
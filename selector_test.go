@@ -0,0 +1,30 @@
+package main
+
+import (
+	"math"
+	"net"
+	"testing"
+)
+
+func TestWeightedSelectorDistribution(t *testing.T) {
+	weights := []uint32{1, 3, 6}
+	addrs := testIface(t, 0, "eth0", "10.0.0.1/8", "10.0.0.2/8", "10.0.0.3/8").Addresses()
+	sel := WeightedSelector(weights...)
+	const flows = 30000
+	counts := make(map[*InterfaceAddress]int)
+	for i := range flows {
+		src := net.IPv4(192, 168, byte(i>>8), byte(i)).To4()
+		dst := net.IPv4(8, 8, byte(i>>4), byte(i*7)).To4()
+		a := sel(addrs, src, dst)
+		if again := sel(addrs, src, dst); again != a {
+			t.Fatalf("flow %v -> %v got %v, then %v", src, dst, a.IP, again.IP)
+		}
+		counts[a]++
+	}
+	for i, a := range addrs {
+		want := float64(flows) * float64(weights[i]) / 10
+		if got := float64(counts[a]); math.Abs(got-want) > 0.05*want {
+			t.Errorf("address %v got %v flows, want about %v", a.IP, got, want)
+		}
+	}
+}
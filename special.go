@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+)
+
+// ErrMulticast is returned, with WithSpecialAddresses, for a multicast
+// destination that only a default route covers.
+var ErrMulticast = errors.New("no multicast route")
+
+// WithSpecialAddresses makes RouteWithSrc and RouteAddr treat some
+// destinations as a host does rather than by longest prefix match alone:
+//
+//   - loopback destinations go out a loopback interface, one with a loopback
+//     address, if there is one;
+//   - multicast destinations need a route more specific than the default
+//     route and otherwise fail with ErrMulticast;
+//   - link-local destinations go out the interface holding the source
+//     address, if one does, and are delivered on-link.
+//
+// Destinations the rules do not settle are resolved as usual.
+func WithSpecialAddresses() Option {
+	return func(r *Router) {
+		r.special = true
+	}
+}
+
+// resolveSpecial applies the WithSpecialAddresses rules to q, reporting
+// whether they settled it.
+func (r *Router) resolveSpecial(t *table, q query) (res resolution, ok bool, err error) {
+	dst := q.dst
+	switch {
+	case dst.IsLoopback():
+		for _, iface := range r.upInterfaces() {
+			if addr := loopbackAddress(iface, dst); addr != nil {
+				return resolution{iface: iface, addr: addr, nextHop: NextHop{OnLink: true}, mtu: iface.EffectiveMTU()}, true, nil
+			}
+		}
+	case dst.IsMulticast():
+		rt, err := r.bestMatch(t, q)
+		if err != nil {
+			return resolution{}, true, err
+		}
+		if rt == nil || isDefault(rt.Dst) {
+			return resolution{}, true, fmt.Errorf("%w for %v", ErrMulticast, dst)
+		}
+	case dst.IsLinkLocalUnicast() && q.src != nil:
+		for _, iface := range r.upInterfaces() {
+			for _, a := range iface.addrs {
+				if a.IP.Equal(q.src) {
+					return resolution{iface: iface, addr: a, nextHop: NextHop{OnLink: true}, mtu: iface.EffectiveMTU()}, true, nil
+				}
+			}
+		}
+	}
+	return resolution{}, false, nil
+}
+
+// upInterfaces returns the interfaces that are up, by increasing Id.
+func (r *Router) upInterfaces() []*Interface {
+	var up []*Interface
+	for _, iface := range r.ifaces {
+		if !iface.down {
+			up = append(up, iface)
+		}
+	}
+	sort.Slice(up, func(i, j int) bool { return up[i].Id < up[j].Id })
+	return up
+}
+
+// loopbackAddress returns iface's loopback address of dst's family, or its
+// first loopback address of the other family, or nil.
+func loopbackAddress(iface *Interface, dst net.IP) *InterfaceAddress {
+	var other *InterfaceAddress
+	for _, a := range iface.addrs {
+		if !a.IP.IsLoopback() {
+			continue
+		}
+		if (a.IP.To4() != nil) == (dst.To4() != nil) {
+			return a
+		}
+		if other == nil {
+			other = a
+		}
+	}
+	return other
+}
+
+func isDefault(n *net.IPNet) bool {
+	ones, _ := n.Mask.Size()
+	return ones == 0
+}
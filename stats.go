@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net"
+	"sort"
+	"sync/atomic"
+)
+
+// RouteStat is a snapshot of one route's hit counter.
+type RouteStat struct {
+	Table    int
+	Dst      *net.IPNet
+	Iface    int64
+	Priority uint32
+	Hits     uint64
+}
+
+// Hits returns how many lookups this route has won since it was added or the
+// router's stats were last reset.
+func (rt *RTInfo) Hits() uint64 {
+	return atomic.LoadUint64(&rt.hits)
+}
+
+// Stats returns the hit counters of the routes in every table, most hit
+// first. Routes with equal counts are ordered by table, then IPv4 before
+// IPv6, then lookup order.
+func (r *Router) Stats() []RouteStat {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var stats []RouteStat
+	for _, id := range r.tableIDs() {
+		t := r.tables[id]
+		for _, routes := range []routeSlice{t.v4.routes, t.v6.routes} {
+			for _, rt := range routes {
+				stats = append(stats, RouteStat{Table: id, Dst: rt.Dst, Iface: rt.Iface, Priority: rt.Priority, Hits: rt.Hits()})
+			}
+		}
+	}
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].Hits > stats[j].Hits })
+	return stats
+}
+
+// ResetStats zeroes every route's hit counter.
+func (r *Router) ResetStats() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, t := range r.tables {
+		for _, routes := range []routeSlice{t.v4.routes, t.v6.routes} {
+			for _, rt := range routes {
+				atomic.StoreUint64(&rt.hits, 0)
+			}
+		}
+	}
+}
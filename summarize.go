@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"slices"
+	"sort"
+)
+
+// Summary is one aggregated prefix returned by Summarize.
+type Summary struct {
+	Dst      *net.IPNet
+	Iface    int64
+	Priority uint32
+	Type     RouteType
+	Routes   int // routes of the main table the prefix stands for
+}
+
+// Summarize returns the main table's destinations collapsed into the fewest
+// prefixes covering them: routes of one type via one interface at one
+// priority are merged where they are contained in another or, as two halves,
+// fill their parent prefix. Routes via other interfaces are not taken into
+// account, so a summary may cover a more specific route that lookups prefer.
+// The table itself is left unchanged. Summaries are ordered IPv4 first, then
+// by address, prefix length and interface.
+func (r *Router) Summarize() []Summary {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	type group struct {
+		iface    int64
+		priority uint32
+		typ      RouteType
+	}
+	var out []Summary
+	for _, f := range []*routeFamily{&r.main.v4, &r.main.v6} {
+		groups := make(map[group][]Summary)
+		for _, rt := range f.routes {
+			if rt.expired() {
+				continue
+			}
+			g := group{rt.Iface, rt.Priority, rt.Type}
+			groups[g] = append(groups[g], Summary{Dst: rt.Dst, Iface: rt.Iface, Priority: rt.Priority, Type: rt.Type, Routes: 1})
+		}
+		var family []Summary
+		for _, s := range groups {
+			family = append(family, summarize(s)...)
+		}
+		sort.Slice(family, func(i, j int) bool {
+			a, b := family[i], family[j]
+			if c := bytes.Compare(a.Dst.IP, b.Dst.IP); c != 0 {
+				return c < 0
+			}
+			if aOnes, bOnes := prefixLen(a.Dst), prefixLen(b.Dst); aOnes != bOnes {
+				return aOnes < bOnes
+			}
+			return a.Iface < b.Iface
+		})
+		out = append(out, family...)
+	}
+	return out
+}
+
+// summarize collapses the prefixes of one group until neither containment
+// nor sibling merging applies.
+func summarize(s []Summary) []Summary {
+	for {
+		sort.Slice(s, func(i, j int) bool {
+			if c := bytes.Compare(s[i].Dst.IP, s[j].Dst.IP); c != 0 {
+				return c < 0
+			}
+			return prefixLen(s[i].Dst) < prefixLen(s[j].Dst)
+		})
+		merged := s[:0]
+		changed := false
+		for _, cur := range s {
+			if len(merged) == 0 {
+				merged = append(merged, cur)
+				continue
+			}
+			last := &merged[len(merged)-1]
+			switch {
+			case last.Dst.Contains(cur.Dst.IP):
+				last.Routes += cur.Routes
+				changed = true
+			case siblings(last.Dst, cur.Dst):
+				ones, bits := last.Dst.Mask.Size()
+				mask := net.CIDRMask(ones-1, bits)
+				last.Dst = &net.IPNet{IP: last.Dst.IP.Mask(mask), Mask: mask}
+				last.Routes += cur.Routes
+				changed = true
+			default:
+				merged = append(merged, cur)
+			}
+		}
+		s = merged
+		if !changed {
+			return s
+		}
+	}
+}
+
+// siblings reports whether a and b are the two halves of one prefix.
+func siblings(a, b *net.IPNet) bool {
+	aOnes, bits := a.Mask.Size()
+	bOnes, _ := b.Mask.Size()
+	if aOnes != bOnes || aOnes == 0 || a.IP.Equal(b.IP) {
+		return false
+	}
+	parent := net.CIDRMask(aOnes-1, bits)
+	return a.IP.Mask(parent).Equal(b.IP.Mask(parent))
+}
+
+func prefixLen(n *net.IPNet) int {
+	ones, _ := n.Mask.Size()
+	return ones
+}
+
+// DestinationsForInterface returns the set of destinations the main table's
+// unexpired unicast routes via interface id cover, IPv4 first and by address
+// within a family, e.g. to build an allow-list for the interface. Duplicate
+// and contained prefixes are dropped and sibling halves merged, so the result
+// covers exactly the same addresses with the fewest prefixes. Like Summarize
+// it ignores routes via other interfaces, so some of those addresses may
+// egress elsewhere.
+func (r *Router) DestinationsForInterface(id int64) []*net.IPNet {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []*net.IPNet
+	for _, f := range []*routeFamily{&r.main.v4, &r.main.v6} {
+		var s []Summary
+		for _, rt := range f.routes {
+			if rt.Iface == id && rt.Type == RouteUnicast && !rt.expired() {
+				s = append(s, Summary{Dst: rt.Dst})
+			}
+		}
+		for _, sum := range summarize(s) {
+			out = append(out, &net.IPNet{IP: slices.Clone(sum.Dst.IP), Mask: slices.Clone(sum.Dst.Mask)})
+		}
+	}
+	return out
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+)
+
+// MainTable is the id of the table used by every Router method that does not
+// take a table id, as in Linux.
+const MainTable = 254
+
+// table is one routing table, holding routes of both families.
+type table struct {
+	id     int
+	v4, v6 routeFamily
+}
+
+// familyOf returns the routes for ip's address family along with ip in that
+// family's byte length. An IPv4-mapped ip belongs to IPv4.
+func (t *table) familyOf(ip net.IP) (*routeFamily, net.IP, error) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &t.v4, ip4, nil
+	}
+	if ip16 := ip.To16(); ip16 != nil {
+		return &t.v6, ip16, nil
+	}
+	return nil, nil, ErrInvalidIP
+}
+
+// familyOfNet returns the routes for a prefix normalized by normalizeNet.
+func (t *table) familyOfNet(n *net.IPNet) *routeFamily {
+	if len(n.IP) == net.IPv4len {
+		return &t.v4
+	}
+	return &t.v6
+}
+
+// AddRoutesToTable is AddRoutes for the table with the given id, creating the
+// table if needed.
+func (r *Router) AddRoutesToTable(id int, priority uint32, routes ...*Route) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.tables[id]
+	if t == nil {
+		t = &table{id: id}
+		r.tables[id] = t
+	}
+	var errs []error
+	for i, route := range routes {
+		if _, err := r.addRoute(t, priority, route); err != nil {
+			errs = append(errs, fmt.Errorf("route %d (dst %q): %w", i, route.Dst, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LookupInTable is Lookup in the table with the given id.
+func (r *Router) LookupInTable(id int, src, dst net.IP) (*RTInfo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t := r.tables[id]
+	if t == nil {
+		return nil, fmt.Errorf("no routing table %d", id)
+	}
+	return r.route(t, src, dst)
+}
+
+// Tables returns the ids of all tables, in increasing order.
+func (r *Router) Tables() []int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.tableIDs()
+}
+
+func (r *Router) tableIDs() []int {
+	ids := make([]int, 0, len(r.tables))
+	for id := range r.tables {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"net"
+	"slices"
+	"sort"
+)
+
+// routeFamily holds the routes of one address family: the sorted slice used
+// for listing and the trie used for lookups.
+type routeFamily struct {
+	routes routeSlice
+	trie   trieNode
+}
+
+// add inserts rt into the slice in routeSlice order, after any equal
+// entries, and into the trie.
+func (f *routeFamily) add(rt *RTInfo) {
+	i := sort.Search(len(f.routes), func(i int) bool { return routeLess(rt, f.routes[i]) })
+	f.routes = slices.Insert(f.routes, i, rt)
+	f.trie.insert(rt)
+}
+
+// removeFunc drops the routes matching fn from both the slice and the trie
+// and returns how many were dropped.
+func (f *routeFamily) removeFunc(fn func(*RTInfo) bool) int {
+	var removed []*RTInfo
+	n := f.routes.removeFunc(func(rt *RTInfo) bool {
+		if fn(rt) {
+			removed = append(removed, rt)
+			return true
+		}
+		return false
+	})
+	for _, rt := range removed {
+		f.trie.remove(rt)
+	}
+	return n
+}
+
+// defaultRoute returns the preferred unexpired /0 route, see preferred.
+// Those all live at the trie root.
+func (f *routeFamily) defaultRoute() (*RTInfo, bool) {
+	return preferred(f.trie.routes, func(*RTInfo) bool { return true })
+}
+
+// exact returns the preferred unexpired route whose Dst is exactly n, a
+// prefix normalized by normalizeNet of the family's length.
+func (f *routeFamily) exact(n *net.IPNet) (*RTInfo, bool) {
+	ones, _ := n.Mask.Size()
+	node := &f.trie
+	for i := 0; i < ones && node != nil; i++ {
+		node = node.child[bitAt(n.IP, i)]
+	}
+	if node == nil {
+		return nil, false
+	}
+	return preferred(node.routes, func(rt *RTInfo) bool { return samePrefix(rt.Dst, n) })
+}
+
+// preferred picks the first of the unexpired routes that match accepts, in
+// routeSlice order, that applies to any source and flow: the one with the
+// lowest AdminDistance, then Priority, then interface id. When every one of
+// them has a source prefix or flow criteria, the first of those is returned
+// instead.
+func preferred(routes routeSlice, match func(*RTInfo) bool) (*RTInfo, bool) {
+	var restricted *RTInfo
+	for _, rt := range routes {
+		switch {
+		case rt.expired() || !match(rt):
+		case srcBits(rt) != 0 || flowBits(rt) != 0:
+			if restricted == nil {
+				restricted = rt
+			}
+		default:
+			return rt, true
+		}
+	}
+	return restricted, restricted != nil
+}
+
+// rebuild re-sorts the slice and rebuilds the trie from it. Equal entries
+// keep their relative order.
+func (f *routeFamily) rebuild() {
+	sort.Stable(f.routes)
+	f.trie = trieNode{}
+	for _, rt := range f.routes {
+		f.trie.insert(rt)
+	}
+}
+
+// trieNode is a node of a binary trie over destination prefix bits. routes
+// holds the entries whose Dst ends exactly at this node, in routeSlice order.
+type trieNode struct {
+	child  [2]*trieNode
+	routes routeSlice
+}
+
+func (n *trieNode) insert(rt *RTInfo) {
+	ones, _ := rt.Dst.Mask.Size()
+	node := n
+	for i := 0; i < ones; i++ {
+		b := bitAt(rt.Dst.IP, i)
+		if node.child[b] == nil {
+			node.child[b] = &trieNode{}
+		}
+		node = node.child[b]
+	}
+	i := sort.Search(len(node.routes), func(i int) bool { return routeLess(rt, node.routes[i]) })
+	node.routes = slices.Insert(node.routes, i, rt)
+}
+
+// remove drops rt from the trie, pruning nodes left empty. It reports whether
+// n itself is now empty.
+func (n *trieNode) remove(rt *RTInfo) bool {
+	ones, _ := rt.Dst.Mask.Size()
+	return n.removeAt(rt, 0, ones)
+}
+
+func (n *trieNode) removeAt(rt *RTInfo, depth, ones int) bool {
+	if depth == ones {
+		if i := slices.Index(n.routes, rt); i >= 0 {
+			n.routes = slices.Delete(n.routes, i, i+1)
+		}
+	} else if c := n.child[bitAt(rt.Dst.IP, depth)]; c != nil && c.removeAt(rt, depth+1, ones) {
+		n.child[bitAt(rt.Dst.IP, depth)] = nil
+	}
+	return len(n.routes) == 0 && n.child[0] == nil && n.child[1] == nil
+}
+
+// match calls fn for every route whose Dst contains ip, longest prefix first
+// and in routeSlice order within a prefix, until fn returns false. ip must
+// have the length of the family stored in the trie.
+func (n *trieNode) match(ip net.IP, fn func(*RTInfo) bool) {
+	var path [8*net.IPv6len + 1]*trieNode
+	nodes := path[:0]
+	for node := n; node != nil; {
+		nodes = append(nodes, node)
+		depth := len(nodes) - 1
+		if depth == 8*len(ip) {
+			break
+		}
+		node = node.child[bitAt(ip, depth)]
+	}
+	for i := len(nodes) - 1; i >= 0; i-- {
+		for _, rt := range nodes[i].routes {
+			if !fn(rt) {
+				return
+			}
+		}
+	}
+}
+
+func bitAt(ip net.IP, i int) int {
+	return int(ip[i/8]>>(7-uint(i%8))) & 1
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+// ValidateRoutes runs the checks AddRoutes would on routes, and a few it
+// does not, without installing anything: every problem is returned, one
+// error per problem, so that a batch can be rejected as a whole. Besides the
+// route's own prefixes and interface it reports a NextHop that is not an IP
+// address, an interface failing Validate, an interface that would replace a
+// different one registered under its Id, and a route duplicating one already
+// in the main table or earlier in the batch. A nil result means AddRoutes
+// would install all the routes as given.
+func (r *Router) ValidateRoutes(routes ...*Route) []error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	type key struct {
+		src, dst string
+		iface    int64
+		priority uint32
+	}
+	keyOf := func(src, dst *net.IPNet, iface int64, priority uint32) key {
+		k := key{dst: dst.String(), iface: iface, priority: priority}
+		if src != nil {
+			k.src = src.String()
+		}
+		return k
+	}
+	seen := make(map[key]bool)
+	for _, f := range []*routeFamily{&r.main.v4, &r.main.v6} {
+		for _, rt := range f.routes {
+			seen[keyOf(rt.Src, rt.Dst, rt.Iface, rt.Priority)] = true
+		}
+	}
+	ifaces := make(map[int64]*Interface)
+	var errs []error
+	for i, route := range routes {
+		fail := func(err error) {
+			errs = append(errs, fmt.Errorf("route %d (dst %q): %w", i, route.Dst, err))
+		}
+		iface, src, dst, err := route.prepare()
+		if err != nil {
+			fail(err)
+			continue
+		}
+		if route.NextHop != "" && route.NextHopIP() == nil {
+			fail(fmt.Errorf("invalid next hop %q", route.NextHop))
+		}
+		id := NoInterface
+		if iface != nil {
+			id = iface.Id
+			if err := iface.Validate(); err != nil {
+				fail(err)
+			}
+			other := ifaces[id]
+			if other == nil {
+				other = r.ifaces[id]
+			}
+			if other != nil && other != iface {
+				fail(fmt.Errorf("interface %d (%s) would replace interface %q", id, iface.Name, other.Name))
+			}
+			ifaces[id] = iface
+		}
+		k := keyOf(src, dst, id, route.Priority)
+		if seen[k] {
+			fail(fmt.Errorf("duplicates a route to %v via interface %d at priority %d", dst, id, route.Priority))
+		}
+		seen[k] = true
+	}
+	return errs
+}
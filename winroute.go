@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// routePrintRow is one active route of `route print`, with the interface
+// given by address (IPv4) or index (IPv6).
+type routePrintRow struct {
+	line             int
+	dst              *net.IPNet
+	gateway          string
+	ifaceAddr        net.IP
+	ifaceIndex       int64
+	metric           uint32
+	hasIndex, onLink bool
+}
+
+// ParseRoutePrint builds a Router from the text output of Windows
+// `route print`. Interfaces are created from the Interface List, keeping
+// their index as Id and their description as Name, and carry the IPv6
+// addresses of their on-link /128 routes. The IPv4 table names interfaces by
+// address only, so each distinct IPv4 interface address gets an interface of
+// its own, named by the address and numbered after the listed ones. An
+// address takes the mask of the longest on-link route around it on its
+// interface. Metric becomes the route Priority and an On-link gateway leaves
+// the route without a NextHop. Persistent routes are not imported, since the
+// active ones include them.
+func ParseRoutePrint(rd io.Reader) (*Router, error) {
+	var rows []routePrintRow
+	ifaces := make(map[int64]*Interface)
+	var section, part string
+	var pending *routePrintRow // IPv6 row whose gateway wrapped to the next line
+	sc := bufio.NewScanner(rd)
+	for n := 1; sc.Scan(); n++ {
+		text := strings.TrimSpace(sc.Text())
+		switch {
+		case text == "" || strings.HasPrefix(text, "="):
+			continue
+		case text == "Interface List":
+			section, part = "list", ""
+			continue
+		case text == "IPv4 Route Table" || text == "IPv6 Route Table":
+			section, part = text[:4], ""
+			continue
+		case text == "Active Routes:" || text == "Persistent Routes:":
+			part = text
+			continue
+		}
+		fields := strings.Fields(text)
+		switch {
+		case section == "list":
+			index, name, ok := routePrintInterface(text)
+			if !ok {
+				return nil, fmt.Errorf("line %d: invalid interface %q", n, text)
+			}
+			ifaces[index] = &Interface{Id: index, Name: name}
+		case part != "Active Routes:" || fields[0] == "Network" || fields[0] == "If":
+			// persistent routes and column headers
+		case pending != nil && len(fields) == 1:
+			pending.gateway, pending.onLink = fields[0], fields[0] == "On-link"
+			rows = append(rows, *pending)
+			pending = nil
+		case section == "IPv4":
+			row, err := routePrintV4(fields)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			row.line = n
+			rows = append(rows, row)
+		case section == "IPv6":
+			row, err := routePrintV6(fields)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			row.line = n
+			if row.gateway == "" {
+				pending = &row
+				continue
+			}
+			rows = append(rows, row)
+		}
+		if pending != nil {
+			return nil, fmt.Errorf("line %d: missing gateway", n)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if pending != nil {
+		return nil, fmt.Errorf("line %d: missing gateway", pending.line)
+	}
+
+	next := int64(0)
+	for id := range ifaces {
+		next = max(next, id+1)
+	}
+	byAddr := make(map[string]*Interface)
+	ifaceOf := func(row *routePrintRow) *Interface {
+		if row.hasIndex {
+			if ifaces[row.ifaceIndex] == nil {
+				ifaces[row.ifaceIndex] = &Interface{Id: row.ifaceIndex}
+			}
+			return ifaces[row.ifaceIndex]
+		}
+		key := row.ifaceAddr.String()
+		if byAddr[key] == nil {
+			byAddr[key] = &Interface{Id: next, Name: key}
+			next++
+		}
+		return byAddr[key]
+	}
+	onLink := make(map[*Interface][]*net.IPNet)
+	for i := range rows {
+		if iface := ifaceOf(&rows[i]); rows[i].onLink {
+			onLink[iface] = append(onLink[iface], rows[i].dst)
+		}
+	}
+	for i := range rows {
+		row := &rows[i]
+		iface := ifaceOf(row)
+		ip := row.ifaceAddr
+		if row.hasIndex {
+			if ones, bits := row.dst.Mask.Size(); !row.onLink || ones != bits {
+				continue
+			}
+			ip = row.dst.IP
+		}
+		if err := addRoutePrintAddress(iface, ip, onLink[iface]); err != nil {
+			return nil, fmt.Errorf("line %d: %w", row.line, err)
+		}
+	}
+
+	r := NewRouter()
+	for _, iface := range ifaces {
+		r.setInterface(iface)
+	}
+	for _, row := range rows {
+		route := &Route{iface: ifaceOf(&row), Dst: row.dst.String(), Priority: row.metric}
+		if !row.onLink {
+			route.NextHop = row.gateway
+		}
+		if _, err := r.AddRoute(0, route); err != nil {
+			return nil, fmt.Errorf("line %d: %w", row.line, err)
+		}
+	}
+	return r, nil
+}
+
+// routePrintInterface parses an Interface List line such as
+// "12...00 15 5d 01 02 03 ......Ethernet Adapter", which gives the index,
+// the MAC address if any and the description.
+func routePrintInterface(text string) (index int64, name string, ok bool) {
+	num, rest, ok := strings.Cut(text, "...")
+	if !ok {
+		return 0, "", false
+	}
+	index, err := strconv.ParseInt(strings.TrimSpace(num), 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	rest = strings.TrimLeft(rest, ".")
+	if i := strings.Index(rest, "..."); i >= 0 {
+		rest = rest[i:] // skip the MAC address
+	}
+	return index, strings.TrimSpace(strings.TrimLeft(rest, ".")), true
+}
+
+// routePrintV4 parses "Network Destination, Netmask, Gateway, Interface,
+// Metric".
+func routePrintV4(fields []string) (routePrintRow, error) {
+	if len(fields) != 5 {
+		return routePrintRow{}, fmt.Errorf("expected 5 fields, got %d", len(fields))
+	}
+	ip, mask := net.ParseIP(fields[0]).To4(), net.ParseIP(fields[1]).To4()
+	if ip == nil || mask == nil {
+		return routePrintRow{}, fmt.Errorf("invalid destination %s/%s", fields[0], fields[1])
+	}
+	if _, bits := net.IPMask(mask).Size(); bits == 0 {
+		return routePrintRow{}, fmt.Errorf("non-contiguous mask %s", fields[1])
+	}
+	row := routePrintRow{
+		dst:       &net.IPNet{IP: ip.Mask(net.IPMask(mask)), Mask: net.IPMask(mask)},
+		gateway:   fields[2],
+		onLink:    fields[2] == "On-link",
+		ifaceAddr: net.ParseIP(fields[3]),
+	}
+	if row.ifaceAddr == nil {
+		return routePrintRow{}, fmt.Errorf("invalid interface %q", fields[3])
+	}
+	if !row.onLink && net.ParseIP(row.gateway) == nil {
+		return routePrintRow{}, fmt.Errorf("invalid gateway %q", row.gateway)
+	}
+	metric, err := strconv.ParseUint(fields[4], 10, 32)
+	if err != nil {
+		return routePrintRow{}, fmt.Errorf("invalid metric %q", fields[4])
+	}
+	row.metric = uint32(metric)
+	return row, nil
+}
+
+// routePrintV6 parses "If, Metric, Network Destination, Gateway", where the
+// gateway wraps to the next line after a long destination.
+func routePrintV6(fields []string) (routePrintRow, error) {
+	if len(fields) != 3 && len(fields) != 4 {
+		return routePrintRow{}, fmt.Errorf("expected 4 fields, got %d", len(fields))
+	}
+	index, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return routePrintRow{}, fmt.Errorf("invalid interface %q", fields[0])
+	}
+	metric, err := strconv.ParseUint(fields[1], 10, 32)
+	if err != nil {
+		return routePrintRow{}, fmt.Errorf("invalid metric %q", fields[1])
+	}
+	dst, err := parsePrefix(fields[2])
+	if err != nil {
+		return routePrintRow{}, fmt.Errorf("invalid destination: %w", err)
+	}
+	row := routePrintRow{dst: dst, ifaceIndex: index, hasIndex: true, metric: uint32(metric)}
+	if len(fields) == 4 {
+		row.gateway, row.onLink = fields[3], fields[3] == "On-link"
+		if !row.onLink && net.ParseIP(row.gateway) == nil {
+			return routePrintRow{}, fmt.Errorf("invalid gateway %q", row.gateway)
+		}
+	}
+	return row, nil
+}
+
+// addRoutePrintAddress records ip as an address of iface, with the mask of
+// the longest on-link prefix other than a host route that contains it,
+// unless iface already has it.
+func addRoutePrintAddress(iface *Interface, ip net.IP, onLink []*net.IPNet) error {
+	for _, a := range iface.addrs {
+		if a.IP.Equal(ip) {
+			return nil
+		}
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	mask := net.CIDRMask(8*len(ip), 8*len(ip))
+	best := -1
+	for _, n := range onLink {
+		ones, bits := n.Mask.Size()
+		if ones < bits && ones > best && len(n.IP) == len(ip) && n.Contains(ip) {
+			best, mask = ones, n.Mask
+		}
+	}
+	return iface.AddAddress(&InterfaceAddress{IP: ip, Netmask: mask})
+}